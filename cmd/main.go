@@ -3,13 +3,19 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"runtime"
+	"time"
 
 	"github.com/doitintl/eks-lens-agent/internal/aws/firehose"
+	"github.com/doitintl/eks-lens-agent/internal/aws/global"
+	"github.com/doitintl/eks-lens-agent/internal/aws/price"
 	"github.com/doitintl/eks-lens-agent/internal/config"
 	"github.com/doitintl/eks-lens-agent/internal/controller"
+	"github.com/doitintl/eks-lens-agent/internal/usage"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 	"k8s.io/client-go/kubernetes"
@@ -21,7 +27,13 @@ import (
 type contextKey string
 
 const (
-	developModeKey contextKey = "develop-mode"
+	developModeKey           contextKey = "develop-mode"
+	metricsReadHeaderTimeout            = 10 * time.Second
+	// EKS control plane hourly fees
+	defaultStandardSupportFee = 0.10
+	defaultExtendedSupportFee = 0.60
+	// default weight of usage in the blend allocation model
+	defaultUsageWeight = 0.5
 )
 
 var (
@@ -32,18 +44,106 @@ var (
 	errEmptyPath = errors.New("empty path")
 )
 
-func runController(ctx context.Context, cluster string, log *logrus.Entry, clientset *kubernetes.Clientset, uploader firehose.Uploader) error {
-	// load nodes
-	nodesInformer := controller.NewNodesInformer()
-	loaded, err := nodesInformer.Load(ctx, log, cluster, clientset)
+func runController(ctx context.Context, cfg config.Config, log *logrus.Entry, clientset *kubernetes.Clientset, uploader firehose.Uploader) error {
+	// load nodes and resolve their EC2 on-demand, spot or Fargate prices
+	spotPricer, err := price.NewSpotPricer(ctx, cfg.SpotPriceTTL)
+	if err != nil {
+		return errors.Wrap(err, "initializing spot pricer")
+	}
+	source, err := pricingSource(ctx, log, cfg)
+	if err != nil {
+		return errors.Wrap(err, "initializing pricing source")
+	}
+	var pricer price.NodePricer = price.NewNodePricer(
+		price.NewEC2Pricer(ctx, source, cfg.PriceTTL),
+		spotPricer,
+		price.NewFargatePricer(ctx, source, cfg.PriceTTL),
+	)
+	if cfg.PriceOverridesFile != "" {
+		overrides, err := price.LoadOverrides(cfg.PriceOverridesFile)
+		if err != nil {
+			return errors.Wrap(err, "loading price overrides")
+		}
+		pricer = price.WithOverrides(pricer, overrides)
+	}
+	var commitments price.Commitments
+	if cfg.CommitmentsFile != "" {
+		commitments, err = price.LoadCommitments(cfg.CommitmentsFile)
+		if err != nil {
+			return errors.Wrap(err, "loading commitments")
+		}
+	}
+	metadata, err := metadataPolicy(cfg)
+	if err != nil {
+		return errors.Wrap(err, "loading metadata policy")
+	}
+	nodesInformer := controller.NewNodesInformer(pricer, cfg.Weights, commitments, cfg.OverheadPolicy, metadata)
+	loaded, err := nodesInformer.Load(ctx, log, cfg.ClusterName, clientset)
 	if err != nil {
 		return errors.Wrap(err, "loading nodes")
 	}
 	// wait for nodes to be loaded
 	<-loaded
 
+	// load persistent volumes priced from the storage price table
+	storagePrices := price.DefaultStoragePrices()
+	if cfg.StoragePricesFile != "" {
+		storagePrices, err = price.LoadStoragePrices(cfg.StoragePricesFile)
+		if err != nil {
+			return errors.Wrap(err, "loading storage prices")
+		}
+	}
+	volumesInformer := controller.NewVolumesInformer(cfg.ClusterName, storagePrices)
+	if err = volumesInformer.Load(ctx, log, clientset); err != nil {
+		return errors.Wrap(err, "loading persistent volumes")
+	}
+
+	// load LoadBalancer services
+	lbPrices := price.DefaultLoadBalancerPrices()
+	for lbType, hourly := range cfg.LoadBalancerPrices {
+		lbPrices[lbType] = hourly
+	}
+	servicesInformer := controller.NewServicesInformer(cfg.ClusterName, lbPrices)
+	if err = servicesInformer.Load(ctx, log, clientset); err != nil {
+		return errors.Wrap(err, "loading services")
+	}
+
+	// load pod owners: ReplicaSets and Jobs
+	ownersInformer := controller.NewOwnersInformer()
+	if err = ownersInformer.Load(ctx, log, clientset); err != nil {
+		return errors.Wrap(err, "loading pod owners")
+	}
+
+	// load namespaces metadata, if configured
+	var namespacesInformer controller.NamespacesInformer
+	if !metadata.Namespaces.Labels.Empty() || !metadata.Namespaces.Annotations.Empty() {
+		namespacesInformer = controller.NewNamespacesInformer(metadata)
+		if err = namespacesInformer.Load(ctx, log, clientset); err != nil {
+			return errors.Wrap(err, "loading namespaces")
+		}
+	}
+
+	// sample actual pod usage, if enabled
+	var usageCollector *controller.UsageCollector
+	switch cfg.UsageSource {
+	case controller.UsageSourceMetrics:
+		usageCollector = controller.NewUsageCollector(controller.NewMetricsUsageSource(clientset.CoreV1().RESTClient()), cfg.UsageSamplePeriod)
+	case controller.UsageSourceKubelet:
+		usageCollector = controller.NewUsageCollector(controller.NewKubeletUsageSource(clientset.CoreV1().RESTClient(), nodesInformer), cfg.UsageSamplePeriod)
+	}
+
 	// create controller and run it
-	scanner := controller.New(log, clientset, uploader, nodesInformer)
+	scanner := controller.New(log, clientset, uploader, nodesInformer, controller.Options{
+		OverheadPolicy:  cfg.OverheadPolicy,
+		ClusterName:     cfg.ClusterName,
+		ClusterFee:      cfg.ClusterFee,
+		SplitClusterFee: cfg.SplitClusterFee,
+		Usage:           usageCollector,
+		AllocationModel: cfg.AllocationModel,
+		Owners:          ownersInformer,
+		Metadata:        metadata,
+		Namespaces:      namespacesInformer,
+	}, volumesInformer, servicesInformer)
 	err = scanner.Run(ctx)
 	if err != nil {
 		return errors.Wrap(err, "running scanner controller")
@@ -51,6 +151,46 @@ func runController(ctx context.Context, cluster string, log *logrus.Entry, clien
 	return nil
 }
 
+// metadataPolicy returns the default or configured metadata policy with the namespace labels and annotations flags
+func metadataPolicy(cfg config.Config) (*usage.MetadataPolicy, error) {
+	policy := usage.DefaultMetadataPolicy()
+	if cfg.MetadataPolicyFile != "" {
+		var err error
+		if policy, err = usage.LoadMetadataPolicy(cfg.MetadataPolicyFile); err != nil {
+			return nil, err
+		}
+	}
+	policy.Namespaces.Labels.Include = append(policy.Namespaces.Labels.Include, cfg.NamespaceLabels...)
+	policy.Namespaces.Annotations.Include = append(policy.Namespaces.Annotations.Include, cfg.NamespaceAnnotations...)
+	return policy, policy.Compile()
+}
+
+// pricingSource returns AWS public price lists source, backed by the local pricing bundle when configured
+func pricingSource(ctx context.Context, log *logrus.Entry, cfg config.Config) (price.PriceSource, error) {
+	remote := price.NewRemoteSource(&global.AWSRegionExplorer{})
+	var bundle *price.Bundle
+	var err error
+	switch {
+	case cfg.PricingFile != "":
+		bundle, err = price.OpenBundleFile(cfg.PricingFile)
+	case cfg.PricingDir != "":
+		bundle, err = price.OpenBundleDir(cfg.PricingDir)
+	default:
+		return remote, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "opening pricing bundle")
+	}
+	log = log.WithField("bundle-date", bundle.Date().Format(time.RFC3339))
+	// prefer the bundle when AWS public price lists are not reachable
+	if !price.Reachable(ctx) {
+		log.Warn("AWS price lists are not reachable, using pricing bundle")
+		return bundle, nil
+	}
+	log.Info("using AWS price lists with pricing bundle fallback")
+	return price.WithFallback(remote, bundle, log), nil
+}
+
 func run(ctx context.Context, log *logrus.Entry, cfg config.Config) error {
 	ctx, ctxCancel := context.WithCancel(ctx)
 	defer ctxCancel()
@@ -72,12 +212,16 @@ func run(ctx context.Context, log *logrus.Entry, cfg config.Config) error {
 		return errors.Wrap(err, "initializing kubernetes client")
 	}
 
+	if cfg.MetricsAddress != "" {
+		go serveMetrics(ctx, log, cfg.MetricsAddress)
+	}
+
 	uploader, err := firehose.NewUploader(ctx, log, cfg.StreamName)
 	if err != nil {
 		return errors.Wrap(err, "initializing firehose uploader")
 	}
 
-	err = runController(ctx, cfg.ClusterName, log, clientset, uploader)
+	err = runController(ctx, cfg, log, clientset, uploader)
 	if err != nil {
 		return errors.Wrap(err, "running controller")
 	}
@@ -89,6 +233,25 @@ func run(ctx context.Context, log *logrus.Entry, cfg config.Config) error {
 	return nil
 }
 
+// serveMetrics serves Prometheus metrics on /metrics till the context is cancelled
+func serveMetrics(ctx context.Context, log *logrus.Entry, address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: metricsReadHeaderTimeout,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	log.WithField("address", address).Info("serving metrics")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.WithError(err).Error("serving metrics")
+	}
+}
+
 func prepareLogger(cfg config.Config, c *cli.Context) *logrus.Entry {
 	logger := logrus.New()
 
@@ -127,7 +290,10 @@ func prepareLogger(cfg config.Config, c *cli.Context) *logrus.Entry {
 
 func runCmd(c *cli.Context) error {
 	ctx := signals.SetupSignalHandler()
-	cfg := config.LoadConfig(c)
+	cfg, err := config.LoadConfig(c)
+	if err != nil {
+		return errors.Wrap(err, "loading configuration")
+	}
 	log := prepareLogger(cfg, c)
 
 	if err := run(ctx, log, cfg); err != nil {
@@ -137,6 +303,16 @@ func runCmd(c *cli.Context) error {
 	return nil
 }
 
+func downloadPricingCmd(c *cli.Context) error {
+	dir := c.String("dir")
+	err := price.DownloadBundle(c.Context, &global.AWSRegionExplorer{}, dir, c.StringSlice("region"), c.StringSlice("os"))
+	if err != nil {
+		return errors.Wrap(err, "downloading pricing bundle")
+	}
+	fmt.Printf("pricing bundle saved to %s\n", dir)
+	return nil
+}
+
 func main() {
 	app := &cli.App{
 		Commands: []*cli.Command{
@@ -164,6 +340,108 @@ func main() {
 						EnvVars:  []string{"STREAM_NAME"},
 						Category: "Configuration",
 					},
+					&cli.DurationFlag{
+						Name:     "price-ttl",
+						Usage:    "time to keep EC2 and Fargate prices before refreshing them",
+						Value:    price.DefaultPriceTTL,
+						EnvVars:  []string{"PRICE_TTL"},
+						Category: "Pricing",
+					},
+					&cli.DurationFlag{
+						Name:     "spot-price-ttl",
+						Usage:    "time to keep spot prices before refreshing them",
+						Value:    price.DefaultSpotPriceTTL,
+						EnvVars:  []string{"SPOT_PRICE_TTL"},
+						Category: "Pricing",
+					},
+					&cli.StringFlag{
+						Name:     "pricing-file",
+						Usage:    "path to the EC2 pricing file (metered-unit-map JSON) used when AWS price lists are not reachable",
+						EnvVars:  []string{"PRICING_FILE"},
+						Category: "Pricing",
+					},
+					&cli.StringFlag{
+						Name:     "pricing-dir",
+						Usage:    "path to the pricing bundle directory used when AWS price lists are not reachable",
+						EnvVars:  []string{"PRICING_DIR"},
+						Category: "Pricing",
+					},
+					&cli.StringFlag{
+						Name:     "price-overrides",
+						Usage:    "path to YAML file with discount and custom price rules",
+						EnvVars:  []string{"PRICE_OVERRIDES"},
+						Category: "Pricing",
+					},
+					&cli.StringFlag{
+						Name:     "commitments",
+						Usage:    "path to YAML file with Reserved Instances and Savings Plans commitments",
+						EnvVars:  []string{"COMMITMENTS"},
+						Category: "Pricing",
+					},
+					&cli.StringFlag{
+						Name:     "storage-prices",
+						Usage:    "path to YAML file with storage prices by volume type, merged over us-east-1 prices",
+						EnvVars:  []string{"STORAGE_PRICES"},
+						Category: "Pricing",
+					},
+					&cli.StringSliceFlag{
+						Name:     "lb-price",
+						Usage:    "load balancer hourly price by type (type=price), e.g. nlb=0.0252; defaults to us-east-1 prices",
+						EnvVars:  []string{"LB_PRICES"},
+						Category: "Pricing",
+					},
+					&cli.StringFlag{
+						Name:     "usage-source",
+						Usage:    "collect actual pod usage from metrics (metrics.k8s.io API) or kubelet (stats summary); empty to disable",
+						EnvVars:  []string{"USAGE_SOURCE"},
+						Category: "Usage",
+					},
+					&cli.DurationFlag{
+						Name:     "usage-sample-period",
+						Usage:    "pod usage sampling period",
+						Value:    time.Minute,
+						EnvVars:  []string{"USAGE_SAMPLE_PERIOD"},
+						Category: "Usage",
+					},
+					&cli.StringSliceFlag{
+						Name:     "namespace-label",
+						Usage:    "namespace label copied into pod records, e.g. cost-center",
+						EnvVars:  []string{"NAMESPACE_LABELS"},
+						Category: "Metadata",
+					},
+					&cli.StringSliceFlag{
+						Name:     "namespace-annotation",
+						Usage:    "namespace annotation copied into pod records",
+						EnvVars:  []string{"NAMESPACE_ANNOTATIONS"},
+						Category: "Metadata",
+					},
+					&cli.StringFlag{
+						Name:     "metadata-policy",
+						Usage:    "YAML file with pod, namespace and node labels and annotations capture policy",
+						EnvVars:  []string{"METADATA_POLICY"},
+						Category: "Metadata",
+					},
+					&cli.StringFlag{
+						Name:     "allocation-model",
+						Usage:    "resources the node cost is allocated by: requests, usage (average usage), max (greater of requests and usage) or blend (weighted requests and usage); models other than requests require usage source",
+						Value:    usage.AllocationModelRequests,
+						EnvVars:  []string{"ALLOCATION_MODEL"},
+						Category: "Usage",
+					},
+					&cli.Float64Flag{
+						Name:     "usage-weight",
+						Usage:    "weight of usage in the blend allocation model, between 0 and 1",
+						Value:    defaultUsageWeight,
+						EnvVars:  []string{"USAGE_WEIGHT"},
+						Category: "Usage",
+					},
+					&cli.StringFlag{
+						Name:     "metrics-address",
+						Usage:    "address to serve Prometheus metrics on, empty to disable",
+						Value:    ":8080",
+						EnvVars:  []string{"METRICS_ADDRESS"},
+						Category: "Monitoring",
+					},
 					&cli.StringFlag{
 						Name:     "log-level",
 						Usage:    "set log level (debug, info, warning(*), error, fatal, panic)",
@@ -183,9 +461,104 @@ func main() {
 						EnvVars:  []string{"DEV_MODE"},
 						Category: "Configuration",
 					},
+					&cli.Float64Flag{
+						Name:     "cpu-weight",
+						Usage:    "relative unit weight of vCPU",
+						Value:    usage.DefaultCPUWeight,
+						EnvVars:  []string{"CPU_WEIGHT"},
+						Category: "Cost Model",
+					},
+					&cli.Float64Flag{
+						Name:     "memory-weight",
+						Usage:    "relative unit weight of GiB of memory",
+						Value:    usage.DefaultMemoryWeight,
+						EnvVars:  []string{"MEMORY_WEIGHT"},
+						Category: "Cost Model",
+					},
+					&cli.StringFlag{
+						Name:     "overhead-policy",
+						Usage:    "node system-reserved overhead attribution: none (kept in allocatable unit costs), proportional (spread across node pods) or platform (overhead record)",
+						Value:    usage.OverheadPolicyNone,
+						EnvVars:  []string{"OVERHEAD_POLICY"},
+						Category: "Cost Model",
+					},
+					&cli.StringFlag{
+						Name:     "eks-support",
+						Usage:    "EKS cluster Kubernetes version support: standard or extended",
+						Value:    "standard",
+						EnvVars:  []string{"EKS_SUPPORT"},
+						Category: "Cost Model",
+					},
+					&cli.Float64Flag{
+						Name:     "eks-standard-support-fee",
+						Usage:    "EKS control plane hourly fee with standard support, 0 to skip cluster fee records",
+						Value:    defaultStandardSupportFee,
+						EnvVars:  []string{"EKS_STANDARD_SUPPORT_FEE"},
+						Category: "Cost Model",
+					},
+					&cli.Float64Flag{
+						Name:     "eks-extended-support-fee",
+						Usage:    "EKS control plane hourly fee with extended support, 0 to skip cluster fee records",
+						Value:    defaultExtendedSupportFee,
+						EnvVars:  []string{"EKS_EXTENDED_SUPPORT_FEE"},
+						Category: "Cost Model",
+					},
+					&cli.BoolFlag{
+						Name:     "split-cluster-fee",
+						Usage:    "split EKS control plane fee across namespaces proportionally to their requested resources",
+						EnvVars:  []string{"SPLIT_CLUSTER_FEE"},
+						Category: "Cost Model",
+					},
+					&cli.StringSliceFlag{
+						Name:     "gpu-weight",
+						Usage:    "relative unit weight of GPU by instance family (family=weight), e.g. g5=200",
+						EnvVars:  []string{"GPU_WEIGHTS"},
+						Category: "Cost Model",
+					},
+					&cli.StringSliceFlag{
+						Name:     "extended-resource-weight",
+						Usage:    "relative unit weight of extended resource (resource=weight), e.g. aws.amazon.com/neuron=250",
+						EnvVars:  []string{"EXTENDED_RESOURCE_WEIGHTS"},
+						Category: "Cost Model",
+					},
+					&cli.StringSliceFlag{
+						Name:     "extended-resource-price",
+						Usage:    "fixed hourly price of extended resource unit (resource=price), e.g. vpc.amazonaws.com/pod-eni=0.005",
+						EnvVars:  []string{"EXTENDED_RESOURCE_PRICES"},
+						Category: "Cost Model",
+					},
+					&cli.Float64Flag{
+						Name:     "default-gpu-weight",
+						Usage:    "relative unit weight of GPU for instance families without GPU weight",
+						Value:    usage.DefaultGPUWeight,
+						EnvVars:  []string{"DEFAULT_GPU_WEIGHT"},
+						Category: "Cost Model",
+					},
 				},
 				Action: runCmd,
 			},
+			{
+				Name:  "download-pricing",
+				Usage: "download pricing bundle for clusters without access to AWS price lists",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "dir",
+						Usage:    "pricing bundle directory",
+						Required: true,
+					},
+					&cli.StringSliceFlag{
+						Name:     "region",
+						Usage:    "AWS region ID, e.g. us-east-1",
+						Required: true,
+					},
+					&cli.StringSliceFlag{
+						Name:  "os",
+						Usage: "EC2 pricing OS name (Linux, RHEL, SUSE, Windows, Ubuntu Pro)",
+						Value: cli.NewStringSlice("Linux"),
+					},
+				},
+				Action: downloadPricingCmd,
+			},
 		},
 		Name:    "eks-lens-agent",
 		Usage:   "eks-lens-agent is a data collection agent for EKS Lens",
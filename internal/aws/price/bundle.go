@@ -0,0 +1,225 @@
+package price
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+Pricing bundle is a local snapshot of the AWS public price lists for clusters without Internet access:
+
+<dir>/manifest.json                 bundle date, regions and OS names
+<dir>/ec2/<region>/<OS>/index.json  EC2 metered-unit-map, e.g. ec2/us-east-2/Linux/index.json
+<dir>/fargate/<region>/index.json   Amazon ECS price list with Fargate rates
+
+A single pricing file (metered-unit-map) is used for EC2 prices of all nodes, regardless of region and OS.
+*/
+
+const (
+	bundleManifestFile = "manifest.json"
+	bundleIndexFile    = "index.json"
+	// timeout to check the AWS public price lists are reachable
+	reachableTimeout = 5 * time.Second
+	// bundle directories and files permissions
+	bundleDirMode  = 0o755
+	bundleFileMode = 0o644
+)
+
+// BundleManifest describes the pricing bundle content
+type BundleManifest struct {
+	Date    time.Time `json:"date"`
+	Regions []string  `json:"regions"`
+	OS      []string  `json:"os"`
+}
+
+// Bundle is a PriceSource that loads prices from the local pricing bundle
+type Bundle struct {
+	dir  string
+	file string
+	date time.Time
+}
+
+// OpenBundleDir opens the pricing bundle directory created by DownloadBundle
+func OpenBundleDir(dir string) (*Bundle, error) {
+	data, err := os.ReadFile(filepath.Join(dir, bundleManifestFile))
+	if err != nil {
+		return nil, errors.Wrap(err, "reading pricing bundle manifest")
+	}
+	var manifest BundleManifest
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return nil, errors.Wrap(err, "parsing pricing bundle manifest")
+	}
+	return &Bundle{dir: dir, date: manifest.Date}, nil
+}
+
+// OpenBundleFile opens the single pricing file in the metered-unit-map JSON format; the file modification time is the bundle date
+func OpenBundleFile(file string) (*Bundle, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening pricing file")
+	}
+	return &Bundle{file: file, date: info.ModTime()}, nil
+}
+
+// Date returns the date the bundle prices were downloaded
+func (b *Bundle) Date() time.Time {
+	return b.date
+}
+
+// LoadEC2Pricing loads EC2 prices from the bundle
+func (b *Bundle) LoadEC2Pricing(_ context.Context, regionID, osName string) (Prices, error) {
+	path := b.file
+	if path == "" {
+		path = filepath.Join(b.dir, "ec2", regionID, osName, bundleIndexFile)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening EC2 pricing for %s %s from bundle", regionID, osName)
+	}
+	defer f.Close()
+	return parseEC2Pricing(f)
+}
+
+// LoadFargatePricing loads Fargate rates from the bundle
+func (b *Bundle) LoadFargatePricing(_ context.Context, region string) (FargateRates, error) {
+	if b.dir == "" {
+		return FargateRates{}, errors.New("pricing file has no Fargate prices")
+	}
+	f, err := os.Open(filepath.Join(b.dir, "fargate", region, bundleIndexFile))
+	if err != nil {
+		return FargateRates{}, errors.Wrapf(err, "opening Fargate pricing for %s from bundle", region)
+	}
+	defer f.Close()
+	return parseFargatePricing(f)
+}
+
+// DownloadBundle downloads EC2 prices for regions and OS names and Fargate rates for regions into the bundle directory
+func DownloadBundle(ctx context.Context, explorer RegionExplorer, dir string, regions, osNames []string) error {
+	regionMap, err := explorer.GetRegionMap(ctx)
+	if err != nil {
+		return errors.Wrap(err, "loading regions map")
+	}
+	for _, regionID := range regions {
+		region, ok := regionMap[regionID]
+		if !ok {
+			return errors.Errorf("regionID %s not found", regionID)
+		}
+		for _, osName := range osNames {
+			path := filepath.Join(dir, "ec2", regionID, osName, bundleIndexFile)
+			err = downloadPriceList(ctx, ec2PricingAddress(region.LongName, osName), path, func(r io.Reader) error {
+				_, err := parseEC2Pricing(r)
+				return err
+			})
+			if err != nil {
+				return errors.Wrapf(err, "downloading EC2 pricing for %s %s", regionID, osName)
+			}
+		}
+		path := filepath.Join(dir, "fargate", regionID, bundleIndexFile)
+		err = downloadPriceList(ctx, fargatePricingAddress(regionID), path, func(r io.Reader) error {
+			_, err := parseFargatePricing(r)
+			return err
+		})
+		if err != nil {
+			return errors.Wrapf(err, "downloading Fargate pricing for %s", regionID)
+		}
+	}
+	manifest, err := json.MarshalIndent(BundleManifest{
+		Date:    time.Now().UTC(),
+		Regions: regions,
+		OS:      osNames,
+	}, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "serializing pricing bundle manifest")
+	}
+	if err = os.WriteFile(filepath.Join(dir, bundleManifestFile), manifest, bundleFileMode); err != nil {
+		return errors.Wrap(err, "writing pricing bundle manifest")
+	}
+	return nil
+}
+
+// downloadPriceList downloads the price list to path after validating it
+func downloadPriceList(ctx context.Context, address, path string, validate func(r io.Reader) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, http.NoBody)
+	if err != nil {
+		return errors.Wrap(err, "creating price list request")
+	}
+	resp, err := pricingClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "loading price list")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("loading price list %s: %s", address, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "reading price list")
+	}
+	if err = validate(bytes.NewReader(data)); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), bundleDirMode); err != nil {
+		return errors.Wrap(err, "creating pricing bundle directory")
+	}
+	return errors.Wrap(os.WriteFile(path, data, bundleFileMode), "writing price list")
+}
+
+// Reachable checks if the AWS public price lists can be reached
+func Reachable(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, reachableTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, ec2PricingAddress("US East (N. Virginia)", "Linux"), http.NoBody)
+	if err != nil {
+		return false
+	}
+	resp, err := pricingClient.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
+
+type fallbackSource struct {
+	primary  PriceSource
+	fallback PriceSource
+	log      *logrus.Entry
+}
+
+// WithFallback returns PriceSource that loads prices from the fallback source when the primary source fails
+func WithFallback(primary, fallback PriceSource, log *logrus.Entry) PriceSource {
+	return &fallbackSource{
+		primary:  primary,
+		fallback: fallback,
+		log:      log,
+	}
+}
+
+// LoadEC2Pricing loads EC2 prices from the primary source or from the fallback source
+func (s *fallbackSource) LoadEC2Pricing(ctx context.Context, regionID, osName string) (Prices, error) {
+	prices, err := s.primary.LoadEC2Pricing(ctx, regionID, osName)
+	if err == nil {
+		return prices, nil
+	}
+	s.log.WithError(err).WithField("region", regionID).Warn("loading EC2 pricing, using fallback")
+	return s.fallback.LoadEC2Pricing(ctx, regionID, osName) //nolint:wrapcheck
+}
+
+// LoadFargatePricing loads Fargate rates from the primary source or from the fallback source
+func (s *fallbackSource) LoadFargatePricing(ctx context.Context, region string) (FargateRates, error) {
+	rates, err := s.primary.LoadFargatePricing(ctx, region)
+	if err == nil {
+		return rates, nil
+	}
+	s.log.WithError(err).WithField("region", region).Warn("loading Fargate pricing, using fallback")
+	return s.fallback.LoadFargatePricing(ctx, region) //nolint:wrapcheck
+}
@@ -0,0 +1,154 @@
+package price
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const ec2PriceListJSON = `{
+  "regions": {
+    "US East (Ohio)": {
+      "m5.large": {"Instance Type": "m5.large", "price": "0.0960000000"},
+      "c5.xlarge": {"Instance Type": "c5.xlarge", "price": "0.1700000000"}
+    }
+  }
+}`
+
+// writeBundleFile writes the file under the bundle directory
+func writeBundleFile(t *testing.T, dir, content string, elem ...string) string {
+	t.Helper()
+	path := filepath.Join(append([]string{dir}, elem...)...)
+	if err := os.MkdirAll(filepath.Dir(path), bundleDirMode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), bundleFileMode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpenBundleDir(t *testing.T) {
+	dir := t.TempDir()
+	writeBundleFile(t, dir, `{"date": "2023-05-01T10:00:00Z", "regions": ["us-east-2"], "os": ["Linux"]}`, bundleManifestFile)
+	writeBundleFile(t, dir, ec2PriceListJSON, "ec2", "us-east-2", "Linux", bundleIndexFile)
+	writeBundleFile(t, dir, fargatePriceList, "fargate", "us-east-2", bundleIndexFile)
+
+	bundle, err := OpenBundleDir(dir)
+	if err != nil {
+		t.Fatalf("OpenBundleDir() error = %v", err)
+	}
+	if want := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC); !bundle.Date().Equal(want) {
+		t.Errorf("Date() = %v, want %v", bundle.Date(), want)
+	}
+	prices, err := bundle.LoadEC2Pricing(context.Background(), "us-east-2", "Linux")
+	if err != nil {
+		t.Fatalf("LoadEC2Pricing() error = %v", err)
+	}
+	if prices["m5.large"] != 0.096 || prices["c5.xlarge"] != 0.17 {
+		t.Errorf("LoadEC2Pricing() = %v", prices)
+	}
+	if _, err = bundle.LoadEC2Pricing(context.Background(), "us-east-2", "Windows"); err == nil {
+		t.Error("LoadEC2Pricing() expected error for OS missing in bundle")
+	}
+	rates, err := bundle.LoadFargatePricing(context.Background(), "us-east-2")
+	if err != nil {
+		t.Fatalf("LoadFargatePricing() error = %v", err)
+	}
+	if rates.VCPUHour != 0.04048 {
+		t.Errorf("LoadFargatePricing() VCPUHour = %v, want 0.04048", rates.VCPUHour)
+	}
+
+	// directory without manifest
+	if _, err = OpenBundleDir(t.TempDir()); err == nil {
+		t.Error("OpenBundleDir() expected error for directory without manifest")
+	}
+}
+
+func TestOpenBundleFile(t *testing.T) {
+	file := writeBundleFile(t, t.TempDir(), ec2PriceListJSON, "ec2.json")
+	bundle, err := OpenBundleFile(file)
+	if err != nil {
+		t.Fatalf("OpenBundleFile() error = %v", err)
+	}
+	if bundle.Date().IsZero() {
+		t.Error("Date() expected file modification time")
+	}
+	// the pricing file is used for all regions and OS names
+	for _, region := range []string{"us-east-2", "eu-west-1"} {
+		prices, err := bundle.LoadEC2Pricing(context.Background(), region, "RHEL")
+		if err != nil {
+			t.Fatalf("LoadEC2Pricing() error = %v", err)
+		}
+		if prices["m5.large"] != 0.096 {
+			t.Errorf("LoadEC2Pricing() m5.large = %v, want 0.096", prices["m5.large"])
+		}
+	}
+	if _, err = bundle.LoadFargatePricing(context.Background(), "us-east-2"); err == nil {
+		t.Error("LoadFargatePricing() expected error for pricing file")
+	}
+}
+
+// fakePriceSource implements PriceSource interface
+type fakePriceSource struct {
+	prices Prices
+	rates  FargateRates
+	err    error
+}
+
+func (f *fakePriceSource) LoadEC2Pricing(_ context.Context, _, _ string) (Prices, error) {
+	return f.prices, f.err
+}
+
+func (f *fakePriceSource) LoadFargatePricing(_ context.Context, _ string) (FargateRates, error) {
+	return f.rates, f.err
+}
+
+func TestWithFallback(t *testing.T) {
+	log := logrus.NewEntry(logrus.New())
+	remote := &fakePriceSource{prices: Prices{"m5.large": 0.1}, rates: FargateRates{VCPUHour: 0.04}}
+	bundle := &fakePriceSource{prices: Prices{"m5.large": 0.09}, rates: FargateRates{VCPUHour: 0.03}}
+	tests := []struct {
+		name      string
+		remoteErr error
+		wantPrice float64
+		wantVCPU  float64
+	}{
+		{
+			name:      "remote price lists",
+			wantPrice: 0.1,
+			wantVCPU:  0.04,
+		},
+		{
+			name:      "bundle when remote fails",
+			remoteErr: errors.New("no network"),
+			wantPrice: 0.09,
+			wantVCPU:  0.03,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote.err = tt.remoteErr
+			source := WithFallback(remote, bundle, log)
+			prices, err := source.LoadEC2Pricing(context.Background(), "us-east-1", "Linux")
+			if err != nil {
+				t.Fatalf("LoadEC2Pricing() error = %v", err)
+			}
+			if prices["m5.large"] != tt.wantPrice {
+				t.Errorf("LoadEC2Pricing() m5.large = %v, want %v", prices["m5.large"], tt.wantPrice)
+			}
+			rates, err := source.LoadFargatePricing(context.Background(), "us-east-1")
+			if err != nil {
+				t.Fatalf("LoadFargatePricing() error = %v", err)
+			}
+			if rates.VCPUHour != tt.wantVCPU {
+				t.Errorf("LoadFargatePricing() VCPUHour = %v, want %v", rates.VCPUHour, tt.wantVCPU)
+			}
+		})
+	}
+}
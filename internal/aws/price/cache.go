@@ -0,0 +1,168 @@
+package price
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// DefaultPriceTTL is the default time to keep EC2 and Fargate prices before refreshing them
+	DefaultPriceTTL = 24 * time.Hour
+	// DefaultSpotPriceTTL is the default time to keep spot prices before refreshing them
+	DefaultSpotPriceTTL = 1 * time.Hour
+	// maximum time between failed refresh attempts
+	maxRefreshRetry = 1 * time.Minute
+)
+
+var (
+	cacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "eks_lens_price_cache_hits_total",
+		Help: "Number of price lookups served from the cache.",
+	}, []string{"cache"})
+	cacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "eks_lens_price_cache_misses_total",
+		Help: "Number of price lookups that loaded prices.",
+	}, []string{"cache"})
+	cacheRefreshFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "eks_lens_price_cache_refresh_failures_total",
+		Help: "Number of failed background price refreshes.",
+	}, []string{"cache"})
+)
+
+// LoadFunc loads the value of a cache entry
+type LoadFunc[T any] func(ctx context.Context) (T, error)
+
+type cacheEntry[T any] struct {
+	value T
+	// err is the error of the first load
+	err error
+	// ready is closed when the first load is done
+	ready      chan struct{}
+	updated    time.Time
+	attempted  time.Time
+	refreshing bool
+	load       LoadFunc[T]
+}
+
+// Cache is safe for concurrent use. Entries expire after TTL and are refreshed in the background by Run
+// or on lookup, the last known value is served while refreshing and when refresh fails.
+type Cache[T any] struct {
+	mu      sync.Mutex
+	name    string
+	ttl     time.Duration
+	retry   time.Duration
+	entries map[string]*cacheEntry[T]
+}
+
+// NewCache returns a cache with entries expiring after ttl; name is used to label the cache metrics
+func NewCache[T any](name string, ttl time.Duration) *Cache[T] {
+	retry := ttl
+	if retry > maxRefreshRetry {
+		retry = maxRefreshRetry
+	}
+	return &Cache[T]{
+		name:    name,
+		ttl:     ttl,
+		retry:   retry,
+		entries: make(map[string]*cacheEntry[T]),
+	}
+}
+
+// Get returns the cached value for key, loading it with load on first use
+func (c *Cache[T]) Get(ctx context.Context, key string, load LoadFunc[T]) (T, error) {
+	var zero T
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		// first use: load the value, concurrent lookups of the key wait for it
+		entry = &cacheEntry[T]{ready: make(chan struct{}), load: load}
+		c.entries[key] = entry
+		c.mu.Unlock()
+		cacheMisses.WithLabelValues(c.name).Inc()
+		value, err := load(ctx)
+		c.mu.Lock()
+		entry.attempted = time.Now()
+		if err != nil {
+			entry.err = err
+			delete(c.entries, key)
+		} else {
+			entry.value = value
+			entry.updated = entry.attempted
+		}
+		c.mu.Unlock()
+		close(entry.ready)
+		return value, err
+	}
+	c.mu.Unlock()
+
+	// wait for the first load
+	select {
+	case <-entry.ready:
+	case <-ctx.Done():
+		return zero, ctx.Err() //nolint:wrapcheck
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry.err != nil {
+		return zero, entry.err
+	}
+	cacheHits.WithLabelValues(c.name).Inc()
+	if c.expired(entry) {
+		c.refresh(entry)
+	}
+	return entry.value, nil
+}
+
+// Run refreshes expired entries every retry period till the context is done
+func (c *Cache[T]) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.retry)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.refreshExpired()
+		}
+	}
+}
+
+// refreshExpired refreshes the expired entries; entries waiting for the first load are skipped
+func (c *Cache[T]) refreshExpired() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, entry := range c.entries {
+		if !entry.attempted.IsZero() && c.expired(entry) {
+			c.refresh(entry)
+		}
+	}
+}
+
+// expired checks if the entry should be refreshed; must be called with the lock held
+func (c *Cache[T]) expired(entry *cacheEntry[T]) bool {
+	now := time.Now()
+	return !entry.refreshing && now.Sub(entry.updated) >= c.ttl && now.Sub(entry.attempted) >= c.retry
+}
+
+// refresh reloads the entry in the background keeping the last known value on failure; must be called with the lock held
+func (c *Cache[T]) refresh(entry *cacheEntry[T]) {
+	entry.refreshing = true
+	go func() {
+		value, err := entry.load(context.Background())
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		entry.refreshing = false
+		entry.attempted = time.Now()
+		if err != nil {
+			cacheRefreshFailures.WithLabelValues(c.name).Inc()
+			return
+		}
+		entry.value = value
+		entry.updated = entry.attempted
+	}()
+}
@@ -0,0 +1,144 @@
+package price
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCacheGet(t *testing.T) {
+	cache := NewCache[int]("test-get", time.Hour)
+	misses := testutil.ToFloat64(cacheMisses.WithLabelValues("test-get"))
+	hits := testutil.ToFloat64(cacheHits.WithLabelValues("test-get"))
+	var loads int32
+	load := func(context.Context) (int, error) {
+		atomic.AddInt32(&loads, 1)
+		return 42, nil
+	}
+
+	// concurrent lookups load the value once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := cache.Get(context.Background(), "key", load)
+			if err != nil || got != 42 {
+				t.Errorf("Get() = %v, %v, want 42", got, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if loads != 1 {
+		t.Errorf("loads = %d, want 1", loads)
+	}
+	if got := testutil.ToFloat64(cacheMisses.WithLabelValues("test-get")) - misses; got != 1 {
+		t.Errorf("misses = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(cacheHits.WithLabelValues("test-get")) - hits; got != 9 {
+		t.Errorf("hits = %v, want 9", got)
+	}
+}
+
+func TestCacheGetLoadError(t *testing.T) {
+	cache := NewCache[int]("test-error", time.Hour)
+	_, err := cache.Get(context.Background(), "key", func(context.Context) (int, error) {
+		return 0, errors.New("load failed")
+	})
+	if err == nil {
+		t.Fatal("Get() expected error")
+	}
+	// failed load is not cached
+	got, err := cache.Get(context.Background(), "key", func(context.Context) (int, error) {
+		return 7, nil
+	})
+	if err != nil || got != 7 {
+		t.Errorf("Get() = %v, %v, want 7", got, err)
+	}
+}
+
+func TestCacheRefresh(t *testing.T) {
+	cache := NewCache[int]("test-refresh", time.Millisecond)
+	failures := testutil.ToFloat64(cacheRefreshFailures.WithLabelValues("test-refresh"))
+	var value, fail int32 = 1, 0
+	refreshed := make(chan struct{}, 10)
+	load := func(context.Context) (int, error) {
+		defer func() { refreshed <- struct{}{} }()
+		if atomic.LoadInt32(&fail) == 1 {
+			return 0, errors.New("refresh failed")
+		}
+		return int(atomic.LoadInt32(&value)), nil
+	}
+	if got, _ := cache.Get(context.Background(), "key", load); got != 1 {
+		t.Fatalf("Get() = %v, want 1", got)
+	}
+	<-refreshed
+
+	// failed refresh keeps serving the last known value
+	atomic.StoreInt32(&fail, 1)
+	time.Sleep(2 * time.Millisecond)
+	if got, _ := cache.Get(context.Background(), "key", load); got != 1 {
+		t.Errorf("Get() = %v, want 1 while refreshing", got)
+	}
+	<-refreshed
+	time.Sleep(2 * time.Millisecond)
+	if got, _ := cache.Get(context.Background(), "key", load); got != 1 {
+		t.Errorf("Get() = %v, want last known value 1", got)
+	}
+	<-refreshed
+	waitFor(t, func() bool {
+		return testutil.ToFloat64(cacheRefreshFailures.WithLabelValues("test-refresh")) > failures
+	})
+
+	// successful refresh updates the value
+	atomic.StoreInt32(&fail, 0)
+	atomic.StoreInt32(&value, 2)
+	time.Sleep(2 * time.Millisecond)
+	cache.Get(context.Background(), "key", load) //nolint:errcheck
+	<-refreshed
+	waitFor(t, func() bool {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		return cache.entries["key"].value == 2
+	})
+}
+
+// waitFor waits till the condition is met or fails the test after a second
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCacheRun(t *testing.T) {
+	cache := NewCache[int]("test-run", time.Millisecond)
+	var value int32 = 1
+	load := func(context.Context) (int, error) {
+		return int(atomic.LoadInt32(&value)), nil
+	}
+	if got, _ := cache.Get(context.Background(), "key", load); got != 1 {
+		t.Fatalf("Get() = %v, want 1", got)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cache.Run(ctx)
+
+	// expired entry is refreshed without lookups
+	atomic.StoreInt32(&value, 2)
+	waitFor(t, func() bool {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		return cache.entries["key"].value == 2
+	})
+}
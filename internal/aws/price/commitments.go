@@ -0,0 +1,167 @@
+package price
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+/*
+Commitments file example:
+
+commitments:
+  # Reserved Instances: count of instances of the family in the region at the amortized hourly rate per instance
+  - name: ri-m5-2023
+    family: m5
+    region: us-east-1
+    count: 4
+    rate: 0.061
+  # Compute Savings Plan: hourly commitment in USD at the savings plan rate as a fraction of the on-demand price
+  - name: csp-2023
+    hourlyCommitment: 2.5
+    rate: 0.72
+
+Empty family or region matches any family or region. Commitments are applied in the declared order
+to ON_DEMAND EC2 nodes ordered by creation time and name.
+*/
+
+// uncovered fraction of node below which the node is fully covered
+const coverageEpsilon = 1e-9
+
+// Commitment is a declared Reserved Instances or Savings Plan commitment
+type Commitment struct {
+	Name   string `json:"name"`
+	Family string `json:"family,omitempty"`
+	Region string `json:"region,omitempty"`
+	// Count of reserved instances
+	Count int `json:"count,omitempty"`
+	// HourlyCommitment of savings plan in USD
+	HourlyCommitment float64 `json:"hourlyCommitment,omitempty"`
+	// Rate is the amortized hourly rate per reserved instance or the savings plan rate as a fraction of the on-demand price
+	Rate float64 `json:"rate"`
+}
+
+// Commitments are applied in the declared order
+type Commitments []Commitment
+
+// Coverage is the amortized effective hourly price of the node covered by commitments
+type Coverage struct {
+	EffectiveHour float64
+	Commitments   []string
+}
+
+// LoadCommitments loads commitments from the YAML file
+func LoadCommitments(file string) (Commitments, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading commitments")
+	}
+	var spec struct {
+		Commitments Commitments `json:"commitments"`
+	}
+	if err = yaml.UnmarshalStrict(data, &spec); err != nil {
+		return nil, errors.Wrap(err, "parsing commitments")
+	}
+	for _, c := range spec.Commitments {
+		if err = c.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return spec.Commitments, nil
+}
+
+func (c *Commitment) validate() error {
+	if c.Name == "" {
+		return errors.New("commitment must have a name")
+	}
+	if (c.Count > 0) == (c.HourlyCommitment > 0) {
+		return errors.Errorf("commitment %s must have either positive count or hourly commitment", c.Name)
+	}
+	if c.Rate < 0 || (c.HourlyCommitment > 0 && (c.Rate == 0 || c.Rate > 1)) {
+		return errors.Errorf("invalid rate %v of commitment %s", c.Rate, c.Name)
+	}
+	return nil
+}
+
+func (c *Commitment) matches(node *usage.NodeInfo) bool {
+	family, _, _ := strings.Cut(node.InstanceType, ".")
+	return (c.Family == "" || c.Family == family) && (c.Region == "" || c.Region == node.Region)
+}
+
+// Apply applies commitments to the priced ON_DEMAND EC2 nodes and returns the coverage of covered nodes by node name;
+// commitment rates apply to the node list hourly price Cost.ListHour, uncovered usage is charged at the node
+// price after overrides Cost.OverrideHour
+func (cs Commitments) Apply(nodes []*usage.NodeInfo) map[string]Coverage {
+	// fixed, repeatable order of nodes
+	eligible := make([]*usage.NodeInfo, 0, len(nodes))
+	for _, node := range nodes {
+		if node.ComputeType != usage.ComputeTypeFargate && node.CapacityType == usage.CapacityTypeOnDemand && node.Cost.ListHour > 0 {
+			eligible = append(eligible, node)
+		}
+	}
+	sort.SliceStable(eligible, func(i, j int) bool {
+		if !eligible[i].Created.Equal(eligible[j].Created) {
+			return eligible[i].Created.Before(eligible[j].Created)
+		}
+		return eligible[i].Name < eligible[j].Name
+	})
+
+	// uncovered fraction of each node and covered spending
+	uncovered := make(map[string]float64, len(eligible))
+	for _, node := range eligible {
+		uncovered[node.Name] = 1
+	}
+	coverage := make(map[string]Coverage)
+	cover := func(node *usage.NodeInfo, commitment string, spending, fraction float64) {
+		cov := coverage[node.Name]
+		cov.EffectiveHour += spending
+		cov.Commitments = append(cov.Commitments, commitment)
+		coverage[node.Name] = cov
+		uncovered[node.Name] -= fraction
+	}
+	for i := range cs {
+		c := &cs[i]
+		count, budget := c.Count, c.HourlyCommitment
+		for _, node := range eligible {
+			if !c.matches(node) || uncovered[node.Name] <= coverageEpsilon {
+				continue
+			}
+			if c.Count > 0 {
+				// reserved instance covers the whole node
+				if count == 0 {
+					break
+				}
+				if uncovered[node.Name] < 1 {
+					continue
+				}
+				count--
+				cover(node, c.Name, c.Rate, 1)
+				continue
+			}
+			// savings plan covers the node uncovered usage till the hourly commitment is spent
+			if budget <= 0 {
+				break
+			}
+			spending := node.Cost.ListHour * uncovered[node.Name] * c.Rate
+			if spending > budget {
+				spending = budget
+			}
+			budget -= spending
+			cover(node, c.Name, spending, spending/(node.Cost.ListHour*c.Rate))
+		}
+	}
+	// uncovered usage is charged at the price after overrides
+	for _, node := range eligible {
+		if cov, ok := coverage[node.Name]; ok {
+			if rest := uncovered[node.Name]; rest > coverageEpsilon {
+				cov.EffectiveHour += node.Cost.OverrideHour * rest
+			}
+			coverage[node.Name] = cov
+		}
+	}
+	return coverage
+}
@@ -0,0 +1,107 @@
+package price
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+)
+
+func TestLoadCommitments(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr bool
+	}{
+		{
+			name:    "reserved instances and savings plan",
+			content: "commitments:\n- {name: ri, family: m5, region: us-east-1, count: 2, rate: 0.06}\n- {name: sp, hourlyCommitment: 1.5, rate: 0.7}",
+			want:    2,
+		},
+		{name: "no commitments", content: ""},
+		{name: "missing name", content: "commitments:\n- {count: 2, rate: 0.06}", wantErr: true},
+		{name: "count and hourly commitment", content: "commitments:\n- {name: c, count: 2, hourlyCommitment: 1, rate: 0.5}", wantErr: true},
+		{name: "savings plan rate above 1", content: "commitments:\n- {name: sp, hourlyCommitment: 1, rate: 1.5}", wantErr: true},
+		{name: "unknown field", content: "commitments:\n- {name: ri, count: 2, rate: 0.06, term: 1y}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "commitments.yaml")
+			if err := os.WriteFile(file, []byte(tt.content), bundleFileMode); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadCommitments(file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadCommitments() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("LoadCommitments() = %d commitments, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestCommitmentsApply(t *testing.T) {
+	const epsilon = 1e-9
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	node := func(name, instanceType, capacityType string, listHour float64, age time.Duration) *usage.NodeInfo {
+		return &usage.NodeInfo{
+			Name:         name,
+			InstanceType: instanceType,
+			CapacityType: capacityType,
+			Region:       "us-east-1",
+			Created:      created.Add(-age),
+			Cost:         usage.Cost{ListHour: listHour, OverrideHour: listHour},
+		}
+	}
+	nodes := []*usage.NodeInfo{
+		node("m5-new", "m5.large", usage.CapacityTypeOnDemand, 0.1, 0),
+		node("m5-old", "m5.large", usage.CapacityTypeOnDemand, 0.1, time.Hour),
+		node("m5-older", "m5.large", usage.CapacityTypeOnDemand, 0.1, 2*time.Hour),
+		node("c5", "c5.large", usage.CapacityTypeOnDemand, 0.1, time.Hour),
+		node("c5-spot", "c5.large", usage.CapacityTypeSpot, 0.04, time.Hour),
+	}
+	commitments := Commitments{
+		{Name: "ri", Family: "m5", Region: "us-east-1", Count: 2, Rate: 0.06},
+		{Name: "sp", HourlyCommitment: 0.105, Rate: 0.7},
+	}
+	want := map[string]struct {
+		effective   float64
+		commitments []string
+	}{
+		// reserved instances cover the oldest m5 nodes
+		"m5-older": {0.06, []string{"ri"}},
+		"m5-old":   {0.06, []string{"ri"}},
+		// savings plan covers c5 (older) fully, then half of m5-new
+		"c5":     {0.07, []string{"sp"}},
+		"m5-new": {0.035 + 0.05, []string{"sp"}},
+	}
+
+	// repeated application is stable regardless of input order
+	for i := 0; i < 2; i++ {
+		got := commitments.Apply(nodes)
+		if len(got) != len(want) {
+			t.Fatalf("Apply() covered %d nodes, want %d: %+v", len(got), len(want), got)
+		}
+		for name, w := range want {
+			cov, ok := got[name]
+			if !ok {
+				t.Fatalf("Apply() node %s not covered", name)
+			}
+			if math.Abs(cov.EffectiveHour-w.effective) > epsilon {
+				t.Errorf("Apply() node %s effective = %v, want %v", name, cov.EffectiveHour, w.effective)
+			}
+			if len(cov.Commitments) != len(w.commitments) || cov.Commitments[0] != w.commitments[0] {
+				t.Errorf("Apply() node %s commitments = %v, want %v", name, cov.Commitments, w.commitments)
+			}
+		}
+		// reverse nodes order
+		for l, r := 0, len(nodes)-1; l < r; l, r = l+1, r-1 {
+			nodes[l], nodes[r] = nodes[r], nodes[l]
+		}
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/doitintl/eks-lens-agent/internal/aws/global"
 	"github.com/pkg/errors"
@@ -27,38 +29,66 @@ where region is URL encoded long name of the region, e.g. us-east-2 is US%20East
 
 type Prices map[string]float64
 
-var (
-	regionOSPrices = map[string]Prices{}
+// pricingClient loads public price lists
+var pricingClient = &http.Client{Timeout: pricingTimeout}
+
+const (
+	ec2PricingURL  = "https://b0.p.awsstatic.com/pricing/2.0/meteredUnitMaps/ec2/USD/current/ec2-ondemand-without-sec-sel/%s/%s/index.json"
+	pricingTimeout = 2 * time.Minute
 )
 
 type RegionExplorer interface {
 	GetRegionMap(ctx context.Context) (map[string]global.Region, error)
 }
 
-func GetInstancePrice(ctx context.Context, explorer RegionExplorer, regionID, os, osImage, instanceType string) (float64, error) {
+// EC2PriceSource loads EC2 on-demand prices by region ID and OS name (Linux, RHEL, SUSE, Windows, Ubuntu Pro)
+type EC2PriceSource interface {
+	LoadEC2Pricing(ctx context.Context, regionID, osName string) (Prices, error)
+}
+
+// PriceSource loads EC2 and Fargate prices
+type PriceSource interface {
+	EC2PriceSource
+	FargatePriceSource
+}
+
+type remoteSource struct {
+	explorer RegionExplorer
+}
+
+// NewRemoteSource returns PriceSource that loads prices from the AWS public price lists
+func NewRemoteSource(explorer RegionExplorer) PriceSource {
+	return &remoteSource{explorer: explorer}
+}
+
+// LoadEC2Pricing loads EC2 prices from the AWS public price list
+func (s *remoteSource) LoadEC2Pricing(ctx context.Context, regionID, osName string) (Prices, error) {
 	// load regions map
-	regions, err := explorer.GetRegionMap(ctx)
+	regions, err := s.explorer.GetRegionMap(ctx)
 	if err != nil {
-		return 0, errors.Wrap(err, "loading regions map")
+		return nil, errors.Wrap(err, "loading regions map")
 	}
 	// get regionID long name
 	region, ok := regions[regionID]
 	if !ok {
-		return 0, errors.Errorf("regionID %s not found", regionID)
+		return nil, errors.Errorf("regionID %s not found", regionID)
 	}
+	return loadEC2Pricing(region.LongName, osName)
+}
 
-	// construct key = regionID/os
-	key := fmt.Sprintf("%s/%s", regionID, os)
+func getInstancePrice(ctx context.Context, cache *Cache[Prices], source EC2PriceSource, regionID, os, osImage, instanceType string) (float64, error) {
+	// construct key = regionID/os name (Linux, RHEL, SUSE, ...)
+	osName := getOSName(os, osImage)
+	key := fmt.Sprintf("%s/%s", regionID, osName)
 	// lazy load pricing for regionID and os
-	if _, ok = regionOSPrices[key]; !ok {
-		prices, err := loadEC2Pricing(region.LongName, getOSName(os, osImage))
-		if err != nil {
-			return 0, errors.Wrap(err, "loading EC2 pricing")
-		}
-		regionOSPrices[key] = prices
+	prices, err := cache.Get(ctx, key, func(ctx context.Context) (Prices, error) {
+		return source.LoadEC2Pricing(ctx, regionID, osName)
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "loading EC2 pricing")
 	}
 	// get price for instance type
-	price, ok := regionOSPrices[key][instanceType]
+	price, ok := prices[instanceType]
 	if !ok {
 		return 0, errors.Errorf("instance type %s not found", instanceType)
 	}
@@ -86,15 +116,15 @@ func getOSName(os, osImage string) string {
 	}
 }
 
-func loadEC2Pricing(regionLongName, os string) (Prices, error) {
-	// ec2 pricing address
-	const ec2PricingURL = "https://b0.p.awsstatic.com/pricing/2.0/meteredUnitMaps/ec2/USD/current/ec2-ondemand-without-sec-sel/%s/%s/index.json"
+// ec2PricingAddress returns the EC2 price list address for region long name and OS name
+func ec2PricingAddress(regionLongName, os string) string {
 	// URL encode regionLongName name
-	name := url.QueryEscape(regionLongName)
-	// build URL
-	address := fmt.Sprintf(ec2PricingURL, name, os)
+	return fmt.Sprintf(ec2PricingURL, url.QueryEscape(regionLongName), os)
+}
+
+func loadEC2Pricing(regionLongName, os string) (Prices, error) {
 	// load pricing using http client
-	resp, err := http.Get(address) //nolint:gosec
+	resp, err := pricingClient.Get(ec2PricingAddress(regionLongName, os))
 	defer func() {
 		if resp != nil && resp.Body != nil {
 			resp.Body.Close()
@@ -103,23 +133,36 @@ func loadEC2Pricing(regionLongName, os string) (Prices, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "loading EC2 pricing")
 	}
-	// parse pricing
-	var pricing map[string]interface{}
-	if err = json.NewDecoder(resp.Body).Decode(&pricing); err != nil {
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("loading EC2 pricing for %s %s: %s", regionLongName, os, resp.Status)
+	}
+	return parseEC2Pricing(resp.Body)
+}
+
+// ec2PriceList is the metered-unit-map JSON format of EC2 price list
+type ec2PriceList struct {
+	Regions map[string]map[string]struct {
+		InstanceType string `json:"Instance Type"`
+		Price        string `json:"price"`
+	} `json:"regions"`
+}
+
+// parseEC2Pricing parses EC2 price list in the metered-unit-map JSON format
+func parseEC2Pricing(r io.Reader) (Prices, error) {
+	var pricing ec2PriceList
+	if err := json.NewDecoder(r).Decode(&pricing); err != nil {
 		return nil, errors.Wrap(err, "parsing EC2 pricing")
 	}
 	// build map of instance type to price
-	prices := make(map[string]float64)
-	for _, r := range pricing["regions"].(map[string]interface{}) {
-		for _, p := range r.(map[string]interface{}) {
-			v := p.(map[string]interface{})
-			instanceType := v["Instance Type"].(string)
-			price := v["price"].(string)
+	prices := make(Prices)
+	for _, region := range pricing.Regions {
+		for _, p := range region {
 			// convert price to float64
-			prices[instanceType], err = strconv.ParseFloat(price, 64)
+			price, err := strconv.ParseFloat(p.Price, 64)
 			if err != nil {
 				return nil, errors.Wrap(err, "parsing EC2 price")
 			}
+			prices[p.InstanceType] = price
 		}
 	}
 	return prices, nil
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/doitintl/eks-lens-agent/internal/aws/global"
+	"github.com/doitintl/eks-lens-agent/internal/usage"
 )
 
 func Test_loadEC2Pricing(t *testing.T) {
@@ -104,7 +105,13 @@ func TestGetInstancePrice(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := GetInstancePrice(tt.args.ctx, tt.args.explorer, tt.args.regionID, tt.args.os, tt.args.osImage, tt.args.instanceType)
+			pricer := NewEC2Pricer(tt.args.ctx, NewRemoteSource(tt.args.explorer), DefaultPriceTTL)
+			got, err := pricer.GetNodePrice(tt.args.ctx, &usage.NodeInfo{
+				Region:       tt.args.regionID,
+				OS:           tt.args.os,
+				OSImage:      tt.args.osImage,
+				InstanceType: tt.args.instanceType,
+			})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetInstancePrice() error = %v, wantErr %v", err, tt.wantErr)
 				return
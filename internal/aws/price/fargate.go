@@ -0,0 +1,220 @@
+package price
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+	"github.com/pkg/errors"
+)
+
+/*
+Fargate pricing is part of the Amazon ECS price list, e.g. for us-east-1:
+
+https://pricing.us-east-1.amazonaws.com/offers/v1.0/aws/AmazonECS/current/us-east-1/index.json
+
+Usage types are prefixed with the region code (e.g. "USE1-Fargate-vCPU-Hours:perCPU").
+*/
+
+const (
+	// Fargate ephemeral storage included in the price, GiB
+	fargateFreeStorageGiB = 20
+	// bytes in GB: Fargate memory is provisioned in GB, e.g. "0.25vCPU 0.5GB"
+	gigabyte = 1e9
+	// bytes in GiB: Fargate ephemeral storage is provisioned in GiB
+	gibibyte = 1 << 30
+	// millicores in vCPU
+	millicores = 1000
+	// architecture of Graviton based nodes
+	armArch = "arm64"
+	// Amazon ECS price list address
+	ecsPricingURL = "https://pricing.us-east-1.amazonaws.com/offers/v1.0/aws/AmazonECS/current/%s/index.json"
+)
+
+// Fargate usage types without the region code prefix; Fargate Spot is available to ECS tasks only, EKS Fargate pods
+// are billed on-demand
+const (
+	fargateARMVCPUUsage = "Fargate-ARM-vCPU-Hours:perCPU"
+	fargateARMGBUsage   = "Fargate-ARM-GB-Hours"
+	fargateVCPUUsage    = "Fargate-vCPU-Hours:perCPU"
+	fargateGBUsage      = "Fargate-GB-Hours"
+	fargateStorageUsage = "Fargate-EphemeralStorage-GB-Hours"
+)
+
+// FargateRates are the Fargate hourly rates in a region
+type FargateRates struct {
+	VCPUHour      float64
+	GBHour        float64
+	ARMVCPUHour   float64
+	ARMGBHour     float64
+	StorageGBHour float64
+	HasARM        bool
+}
+
+// FargatePriceSource loads Fargate rates by region ID
+type FargatePriceSource interface {
+	LoadFargatePricing(ctx context.Context, region string) (FargateRates, error)
+}
+
+type fargatePricer struct {
+	rates  *Cache[FargateRates]
+	source FargatePriceSource
+}
+
+// NewFargatePricer returns a NodePricer that prices Fargate nodes by provisioned vCPU, memory and ephemeral storage;
+// Fargate rates from the source are refreshed every ttl in the background till the context is done
+func NewFargatePricer(ctx context.Context, source FargatePriceSource, ttl time.Duration) NodePricer {
+	pricer := &fargatePricer{
+		rates:  NewCache[FargateRates]("fargate", ttl),
+		source: source,
+	}
+	go pricer.rates.Run(ctx)
+	return pricer
+}
+
+// GetNodePrice returns the hourly price of the Fargate node capacity provisioned for the pod
+func (p *fargatePricer) GetNodePrice(ctx context.Context, node *usage.NodeInfo) (float64, error) {
+	if node.Region == "" {
+		return 0, errors.Errorf("node %s has no region", node.Name)
+	}
+	if node.Capacity.CPU == 0 || node.Capacity.Memory == 0 {
+		return 0, errors.Errorf("node %s has no provisioned capacity", node.Name)
+	}
+	// lazy load Fargate rates for region
+	region := node.Region
+	rates, err := p.rates.Get(ctx, region, func(ctx context.Context) (FargateRates, error) {
+		return p.source.LoadFargatePricing(ctx, region)
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "loading Fargate pricing")
+	}
+	return rates.Price(node), nil
+}
+
+// Price returns the hourly price of the node provisioned vCPU, memory and ephemeral storage above the free 20 GiB
+func (r FargateRates) Price(node *usage.NodeInfo) float64 {
+	vcpuHour, gbHour := r.VCPUHour, r.GBHour
+	if node.Arch == armArch && r.HasARM {
+		vcpuHour, gbHour = r.ARMVCPUHour, r.ARMGBHour
+	}
+	price := float64(node.Capacity.CPU)/millicores*vcpuHour + float64(node.Capacity.Memory)/gigabyte*gbHour
+	if storage := float64(node.Capacity.StorageEphemeral) / gibibyte; storage > fargateFreeStorageGiB {
+		price += (storage - fargateFreeStorageGiB) * r.StorageGBHour
+	}
+	return price
+}
+
+// LoadFargatePricing loads Fargate rates from the Amazon ECS price list
+func (s *remoteSource) LoadFargatePricing(ctx context.Context, region string) (FargateRates, error) {
+	return loadFargatePricing(ctx, region)
+}
+
+// fargatePricingAddress returns the Amazon ECS price list address for region
+func fargatePricingAddress(region string) string {
+	return fmt.Sprintf(ecsPricingURL, region)
+}
+
+func loadFargatePricing(ctx context.Context, region string) (FargateRates, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fargatePricingAddress(region), http.NoBody)
+	if err != nil {
+		return FargateRates{}, errors.Wrap(err, "creating Fargate pricing request")
+	}
+	resp, err := pricingClient.Do(req)
+	if err != nil {
+		return FargateRates{}, errors.Wrap(err, "loading Fargate pricing")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return FargateRates{}, errors.Errorf("loading Fargate pricing for %s: %s", region, resp.Status)
+	}
+	return parseFargatePricing(resp.Body)
+}
+
+type priceDimension struct {
+	PricePerUnit map[string]string `json:"pricePerUnit"`
+}
+
+type priceTerm struct {
+	PriceDimensions map[string]priceDimension `json:"priceDimensions"`
+}
+
+type priceList struct {
+	Products map[string]struct {
+		Attributes map[string]string `json:"attributes"`
+	} `json:"products"`
+	Terms struct {
+		OnDemand map[string]map[string]priceTerm `json:"OnDemand"`
+	} `json:"terms"`
+}
+
+// parseFargatePricing parses Fargate rates from the Amazon ECS price list
+func parseFargatePricing(r io.Reader) (FargateRates, error) {
+	var pricing priceList
+	if err := json.NewDecoder(r).Decode(&pricing); err != nil {
+		return FargateRates{}, errors.Wrap(err, "parsing Fargate pricing")
+	}
+	var rates FargateRates
+	found := false
+	for sku, product := range pricing.Products {
+		usageType := product.Attributes["usagetype"]
+		if !strings.Contains(usageType, "Fargate") {
+			continue
+		}
+		price, ok, err := onDemandPrice(pricing.Terms.OnDemand[sku])
+		if err != nil {
+			return FargateRates{}, errors.Wrapf(err, "parsing Fargate price for %s", usageType)
+		}
+		if !ok {
+			continue
+		}
+		switch {
+		case isUsageType(usageType, fargateARMVCPUUsage):
+			rates.ARMVCPUHour, rates.HasARM = price, true
+		case isUsageType(usageType, fargateARMGBUsage):
+			rates.ARMGBHour = price
+		case isUsageType(usageType, fargateVCPUUsage):
+			rates.VCPUHour, found = price, true
+		case isUsageType(usageType, fargateGBUsage):
+			rates.GBHour = price
+		case isUsageType(usageType, fargateStorageUsage):
+			rates.StorageGBHour = price
+		}
+	}
+	if !found {
+		return FargateRates{}, errors.New("Fargate vCPU price not found")
+	}
+	return rates, nil
+}
+
+// isUsageType checks if the usage type, optionally prefixed with region code, matches the name
+func isUsageType(usageType, name string) bool {
+	if usageType == name {
+		return true
+	}
+	_, suffix, ok := strings.Cut(usageType, "-")
+	return ok && suffix == name
+}
+
+// onDemandPrice returns the USD price of the product on-demand terms
+func onDemandPrice(terms map[string]priceTerm) (float64, bool, error) {
+	for _, term := range terms {
+		for _, dimension := range term.PriceDimensions {
+			usd, ok := dimension.PricePerUnit["USD"]
+			if !ok {
+				continue
+			}
+			price, err := strconv.ParseFloat(usd, 64)
+			if err != nil {
+				return 0, false, errors.Wrap(err, "parsing USD price")
+			}
+			return price, true, nil
+		}
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,125 @@
+package price
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+)
+
+const fargatePriceList = `{
+  "products": {
+    "SKU1": {"attributes": {"usagetype": "USE1-Fargate-vCPU-Hours:perCPU"}},
+    "SKU2": {"attributes": {"usagetype": "USE1-Fargate-GB-Hours"}},
+    "SKU3": {"attributes": {"usagetype": "USE1-Fargate-ARM-vCPU-Hours:perCPU"}},
+    "SKU4": {"attributes": {"usagetype": "USE1-Fargate-ARM-GB-Hours"}},
+    "SKU5": {"attributes": {"usagetype": "USE1-SpotUsage-Fargate-vCPU-Hours:perCPU"}},
+    "SKU6": {"attributes": {"usagetype": "USE1-SpotUsage-Fargate-GB-Hours"}},
+    "SKU7": {"attributes": {"usagetype": "USE1-Fargate-EphemeralStorage-GB-Hours"}},
+    "SKU8": {"attributes": {"usagetype": "USE1-ECS-Anywhere-Instance-hours"}}
+  },
+  "terms": {
+    "OnDemand": {
+      "SKU1": {"SKU1.T": {"priceDimensions": {"SKU1.T.D": {"pricePerUnit": {"USD": "0.0404800000"}}}}},
+      "SKU2": {"SKU2.T": {"priceDimensions": {"SKU2.T.D": {"pricePerUnit": {"USD": "0.0044450000"}}}}},
+      "SKU3": {"SKU3.T": {"priceDimensions": {"SKU3.T.D": {"pricePerUnit": {"USD": "0.0323800000"}}}}},
+      "SKU4": {"SKU4.T": {"priceDimensions": {"SKU4.T.D": {"pricePerUnit": {"USD": "0.0035600000"}}}}},
+      "SKU5": {"SKU5.T": {"priceDimensions": {"SKU5.T.D": {"pricePerUnit": {"USD": "0.0124600000"}}}}},
+      "SKU6": {"SKU6.T": {"priceDimensions": {"SKU6.T.D": {"pricePerUnit": {"USD": "0.0013700000"}}}}},
+      "SKU7": {"SKU7.T": {"priceDimensions": {"SKU7.T.D": {"pricePerUnit": {"USD": "0.0001110000"}}}}},
+      "SKU8": {"SKU8.T": {"priceDimensions": {"SKU8.T.D": {"pricePerUnit": {"USD": "0.0125000000"}}}}}
+    }
+  }
+}`
+
+func TestParseFargatePricing(t *testing.T) {
+	got, err := parseFargatePricing(strings.NewReader(fargatePriceList))
+	if err != nil {
+		t.Fatalf("parseFargatePricing() error = %v", err)
+	}
+	want := FargateRates{
+		VCPUHour:      0.04048,
+		GBHour:        0.004445,
+		ARMVCPUHour:   0.03238,
+		ARMGBHour:     0.00356,
+		StorageGBHour: 0.000111,
+		HasARM:        true,
+	}
+	if got != want {
+		t.Errorf("parseFargatePricing() = %+v, want %+v", got, want)
+	}
+
+	// price list without Fargate prices
+	if _, err = parseFargatePricing(strings.NewReader(`{"products": {}}`)); err == nil {
+		t.Error("parseFargatePricing() expected error for price list without Fargate prices")
+	}
+}
+
+// fakeFargateSource implements FargatePriceSource interface
+type fakeFargateSource struct {
+	rates FargateRates
+}
+
+func (f *fakeFargateSource) LoadFargatePricing(_ context.Context, _ string) (FargateRates, error) {
+	return f.rates, nil
+}
+
+func TestFargatePricerGetNodePrice(t *testing.T) {
+	const epsilon = 1e-9
+	rates, err := parseFargatePricing(strings.NewReader(fargatePriceList))
+	if err != nil {
+		t.Fatalf("parseFargatePricing() error = %v", err)
+	}
+	pricer := NewFargatePricer(context.Background(), &fakeFargateSource{rates: rates}, DefaultPriceTTL)
+	tests := []struct {
+		name    string
+		node    *usage.NodeInfo
+		want    float64
+		wantErr bool
+	}{
+		{
+			name: "x86 0.25vCPU 0.5GB",
+			node: &usage.NodeInfo{
+				Region:   "us-east-1",
+				Arch:     "amd64",
+				Capacity: usage.Capacity{CPU: 250, Memory: 5e8, StorageEphemeral: 20 << 30},
+			},
+			want: 0.25*0.04048 + 0.5*0.004445,
+		},
+		{
+			name: "Graviton 1vCPU 2GB",
+			node: &usage.NodeInfo{
+				Region:   "us-east-1",
+				Arch:     "arm64",
+				Capacity: usage.Capacity{CPU: 1000, Memory: 2e9},
+			},
+			want: 0.03238 + 2*0.00356,
+		},
+		{
+			name: "ephemeral storage above free 20GiB",
+			node: &usage.NodeInfo{
+				Region:   "us-east-1",
+				Capacity: usage.Capacity{CPU: 1000, Memory: 2e9, StorageEphemeral: 50 << 30},
+			},
+			want: 0.04048 + 2*0.004445 + 30*0.000111,
+		},
+		{
+			name:    "no provisioned capacity",
+			node:    &usage.NodeInfo{Region: "us-east-1"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pricer.GetNodePrice(context.Background(), tt.node)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetNodePrice() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if math.Abs(got-tt.want) > epsilon {
+				t.Errorf("GetNodePrice() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
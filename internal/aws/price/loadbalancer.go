@@ -0,0 +1,13 @@
+package price
+
+// LoadBalancerPrices is the hourly price table by load balancer type of LoadBalancer Services: clb and nlb;
+// ALBs are provisioned for Ingresses, not Services
+type LoadBalancerPrices map[string]float64
+
+// DefaultLoadBalancerPrices returns the load balancer hourly prices of us-east-1, excluding capacity units
+func DefaultLoadBalancerPrices() LoadBalancerPrices {
+	return LoadBalancerPrices{
+		"clb": 0.025,
+		"nlb": 0.0225,
+	}
+}
@@ -0,0 +1,68 @@
+package price
+
+import (
+	"context"
+	"time"
+
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+	"github.com/pkg/errors"
+)
+
+// NodePricer resolves the hourly price of a Kubernetes node
+type NodePricer interface {
+	GetNodePrice(ctx context.Context, node *usage.NodeInfo) (float64, error)
+}
+
+type ec2Pricer struct {
+	source EC2PriceSource
+	prices *Cache[Prices]
+}
+
+// NewEC2Pricer returns a NodePricer that uses EC2 on-demand prices from the source refreshed every ttl
+// in the background till the context is done
+func NewEC2Pricer(ctx context.Context, source EC2PriceSource, ttl time.Duration) NodePricer {
+	pricer := &ec2Pricer{
+		source: source,
+		prices: NewCache[Prices]("ec2", ttl),
+	}
+	go pricer.prices.Run(ctx)
+	return pricer
+}
+
+// GetNodePrice returns the on-demand hourly price of the node instance type
+func (p *ec2Pricer) GetNodePrice(ctx context.Context, node *usage.NodeInfo) (float64, error) {
+	if node.Region == "" {
+		return 0, errors.Errorf("node %s has no region", node.Name)
+	}
+	if node.InstanceType == "" {
+		return 0, errors.Errorf("node %s has no instance type", node.Name)
+	}
+	return getInstancePrice(ctx, p.prices, p.source, node.Region, node.OS, node.OSImage, node.InstanceType)
+}
+
+type nodePricer struct {
+	onDemand NodePricer
+	spot     NodePricer
+	fargate  NodePricer
+}
+
+// NewNodePricer returns a NodePricer that prices Fargate nodes with the Fargate pricer,
+// SPOT nodes with the spot pricer and other nodes with the on-demand pricer
+func NewNodePricer(onDemand, spot, fargate NodePricer) NodePricer {
+	return &nodePricer{
+		onDemand: onDemand,
+		spot:     spot,
+		fargate:  fargate,
+	}
+}
+
+// GetNodePrice returns the hourly price of the node based on its compute and capacity type
+func (p *nodePricer) GetNodePrice(ctx context.Context, node *usage.NodeInfo) (float64, error) {
+	if node.ComputeType == usage.ComputeTypeFargate {
+		return p.fargate.GetNodePrice(ctx, node) //nolint:wrapcheck
+	}
+	if node.CapacityType == usage.CapacityTypeSpot {
+		return p.spot.GetNodePrice(ctx, node) //nolint:wrapcheck
+	}
+	return p.onDemand.GetNodePrice(ctx, node) //nolint:wrapcheck
+}
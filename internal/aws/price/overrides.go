@@ -0,0 +1,179 @@
+package price
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+/*
+Price overrides file example:
+
+# percentage discount off list prices (EDP), applied to all nodes without a fixed rate
+discount: 12.5
+# fixed hourly rates of ON_DEMAND nodes by instance family or instance type; instance type takes precedence
+families:
+  m5: 0.085
+instanceTypes:
+  c5.xlarge: 0.15
+# per-nodegroup overrides take precedence over all other rules: fixed hourly rate or discount percentage
+nodegroups:
+  gpu-workers:
+    price: 2.5
+  batch:
+    discount: 20
+*/
+
+const (
+	// RuleList is the pricing rule of nodes priced by list prices
+	RuleList    = "list"
+	maxDiscount = 100
+)
+
+// NodegroupOverride overrides prices of the nodegroup nodes with fixed hourly rate or discount percentage
+type NodegroupOverride struct {
+	Price    *float64 `json:"price,omitempty"`
+	Discount *float64 `json:"discount,omitempty"`
+}
+
+// Overrides are custom price rules for negotiated discounts and private pricing
+type Overrides struct {
+	Discount      float64                      `json:"discount,omitempty"`
+	Families      map[string]float64           `json:"families,omitempty"`
+	InstanceTypes map[string]float64           `json:"instanceTypes,omitempty"`
+	Nodegroups    map[string]NodegroupOverride `json:"nodegroups,omitempty"`
+}
+
+// RulePricer is a NodePricer that also reports the list price before overrides and the pricing rule
+// that produced the node price
+type RulePricer interface {
+	NodePricer
+	GetNodePriceRule(ctx context.Context, node *usage.NodeInfo) (float64, float64, string, error)
+}
+
+// LoadOverrides loads price overrides from the YAML file
+func LoadOverrides(file string) (*Overrides, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading price overrides")
+	}
+	var overrides Overrides
+	if err = yaml.UnmarshalStrict(data, &overrides); err != nil {
+		return nil, errors.Wrap(err, "parsing price overrides")
+	}
+	if err = overrides.validate(); err != nil {
+		return nil, err
+	}
+	return &overrides, nil
+}
+
+func validDiscount(discount float64) bool {
+	return discount >= 0 && discount <= maxDiscount
+}
+
+func (o *Overrides) validate() error {
+	if !validDiscount(o.Discount) {
+		return errors.Errorf("invalid discount %v%%", o.Discount)
+	}
+	for family, rate := range o.Families {
+		if rate < 0 {
+			return errors.Errorf("invalid hourly rate %v for instance family %s", rate, family)
+		}
+	}
+	for instanceType, rate := range o.InstanceTypes {
+		if rate < 0 {
+			return errors.Errorf("invalid hourly rate %v for instance type %s", rate, instanceType)
+		}
+	}
+	for nodegroup, override := range o.Nodegroups {
+		if (override.Price == nil) == (override.Discount == nil) {
+			return errors.Errorf("nodegroup %s override must have either price or discount", nodegroup)
+		}
+		if override.Price != nil && *override.Price < 0 {
+			return errors.Errorf("invalid hourly rate %v for nodegroup %s", *override.Price, nodegroup)
+		}
+		if override.Discount != nil && !validDiscount(*override.Discount) {
+			return errors.Errorf("invalid discount %v%% for nodegroup %s", *override.Discount, nodegroup)
+		}
+	}
+	return nil
+}
+
+// fixedRate returns the fixed hourly rate and rule for the node, if any
+func (o *Overrides) fixedRate(node *usage.NodeInfo) (float64, string, bool) {
+	if override, ok := o.Nodegroups[node.Nodegroup]; ok && override.Price != nil {
+		return *override.Price, "nodegroup:" + node.Nodegroup, true
+	}
+	// private pricing applies to on-demand EC2 instances
+	if node.ComputeType == usage.ComputeTypeFargate || node.CapacityType == usage.CapacityTypeSpot {
+		return 0, "", false
+	}
+	if rate, ok := o.InstanceTypes[node.InstanceType]; ok {
+		return rate, "instance-type:" + node.InstanceType, true
+	}
+	family, _, _ := strings.Cut(node.InstanceType, ".")
+	if rate, ok := o.Families[family]; ok {
+		return rate, "family:" + family, true
+	}
+	return 0, "", false
+}
+
+// discount returns the discount percentage and rule for the node, if any
+func (o *Overrides) discount(node *usage.NodeInfo) (float64, string, bool) {
+	if override, ok := o.Nodegroups[node.Nodegroup]; ok && override.Discount != nil {
+		return *override.Discount, fmt.Sprintf("nodegroup:%s:discount:%s%%", node.Nodegroup, formatPercent(*override.Discount)), true
+	}
+	if o.Discount > 0 {
+		return o.Discount, fmt.Sprintf("discount:%s%%", formatPercent(o.Discount)), true
+	}
+	return 0, "", false
+}
+
+func formatPercent(percent float64) string {
+	return strconv.FormatFloat(percent, 'f', -1, 64)
+}
+
+type overridePricer struct {
+	pricer    NodePricer
+	overrides *Overrides
+}
+
+// WithOverrides returns RulePricer that applies price overrides to the node prices of the pricer
+func WithOverrides(pricer NodePricer, overrides *Overrides) RulePricer {
+	return &overridePricer{
+		pricer:    pricer,
+		overrides: overrides,
+	}
+}
+
+// GetNodePrice returns the hourly price of the node after price overrides
+func (p *overridePricer) GetNodePrice(ctx context.Context, node *usage.NodeInfo) (float64, error) {
+	price, _, _, err := p.GetNodePriceRule(ctx, node)
+	return price, err
+}
+
+// GetNodePriceRule returns the hourly price of the node after price overrides, the list price before overrides
+// and the rule that produced the price: nodegroup fixed rate, instance type or family fixed rate, nodegroup or
+// global discount off list price, or list price. The list price of fixed rate nodes is zero when unavailable
+func (p *overridePricer) GetNodePriceRule(ctx context.Context, node *usage.NodeInfo) (float64, float64, string, error) {
+	list, err := p.pricer.GetNodePrice(ctx, node)
+	if rate, rule, ok := p.overrides.fixedRate(node); ok {
+		if err != nil {
+			list = 0
+		}
+		return rate, list, rule, nil
+	}
+	if err != nil {
+		return 0, 0, "", err //nolint:wrapcheck
+	}
+	if discount, rule, ok := p.overrides.discount(node); ok {
+		return list * (1 - discount/maxDiscount), list, rule, nil
+	}
+	return list, list, RuleList, nil
+}
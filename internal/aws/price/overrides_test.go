@@ -0,0 +1,133 @@
+package price
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+)
+
+const overridesYAML = `
+discount: 10
+families:
+  m5: 0.08
+instanceTypes:
+  m5.large: 0.07
+nodegroups:
+  gpu-workers:
+    price: 2.5
+  batch:
+    discount: 20
+`
+
+func writeOverrides(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "overrides.yaml")
+	if err := os.WriteFile(file, []byte(content), bundleFileMode); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid overrides", content: overridesYAML},
+		{name: "empty overrides", content: ""},
+		{name: "unknown field", content: "discounts: 10", wantErr: true},
+		{name: "discount above 100%", content: "discount: 120", wantErr: true},
+		{name: "negative family rate", content: "families:\n  m5: -1", wantErr: true},
+		{name: "nodegroup without rule", content: "nodegroups:\n  ng: {}", wantErr: true},
+		{name: "nodegroup with price and discount", content: "nodegroups:\n  ng:\n    price: 1\n    discount: 5", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadOverrides(writeOverrides(t, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadOverrides() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOverridePricerGetNodePriceRule(t *testing.T) {
+	const epsilon = 1e-9
+	overrides, err := LoadOverrides(writeOverrides(t, overridesYAML))
+	if err != nil {
+		t.Fatalf("LoadOverrides() error = %v", err)
+	}
+	pricer := WithOverrides(&fakeNodePricer{price: 1}, overrides)
+	tests := []struct {
+		name     string
+		node     *usage.NodeInfo
+		want     float64
+		wantRule string
+	}{
+		{
+			name:     "instance type rate",
+			node:     &usage.NodeInfo{InstanceType: "m5.large", CapacityType: usage.CapacityTypeOnDemand},
+			want:     0.07,
+			wantRule: "instance-type:m5.large",
+		},
+		{
+			name:     "family rate",
+			node:     &usage.NodeInfo{InstanceType: "m5.xlarge", CapacityType: usage.CapacityTypeOnDemand},
+			want:     0.08,
+			wantRule: "family:m5",
+		},
+		{
+			name:     "nodegroup rate",
+			node:     &usage.NodeInfo{InstanceType: "m5.large", Nodegroup: "gpu-workers"},
+			want:     2.5,
+			wantRule: "nodegroup:gpu-workers",
+		},
+		{
+			name:     "nodegroup discount",
+			node:     &usage.NodeInfo{InstanceType: "c5.large", Nodegroup: "batch"},
+			want:     0.8,
+			wantRule: "nodegroup:batch:discount:20%",
+		},
+		{
+			name:     "global discount",
+			node:     &usage.NodeInfo{InstanceType: "c5.large", CapacityType: usage.CapacityTypeOnDemand},
+			want:     0.9,
+			wantRule: "discount:10%",
+		},
+		{
+			name:     "spot node ignores family rate",
+			node:     &usage.NodeInfo{InstanceType: "m5.large", CapacityType: usage.CapacityTypeSpot},
+			want:     0.9,
+			wantRule: "discount:10%",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, list, rule, err := pricer.GetNodePriceRule(context.Background(), tt.node)
+			if err != nil {
+				t.Fatalf("GetNodePriceRule() error = %v", err)
+			}
+			if math.Abs(got-tt.want) > epsilon {
+				t.Errorf("GetNodePriceRule() price = %v, want %v", got, tt.want)
+			}
+			// list price is the price before overrides
+			if list != 1 {
+				t.Errorf("GetNodePriceRule() list price = %v, want 1", list)
+			}
+			if rule != tt.wantRule {
+				t.Errorf("GetNodePriceRule() rule = %v, want %v", rule, tt.wantRule)
+			}
+		})
+	}
+
+	// list price without overrides
+	got, list, rule, err := WithOverrides(&fakeNodePricer{price: 1}, &Overrides{}).GetNodePriceRule(context.Background(), &usage.NodeInfo{InstanceType: "c5.large"})
+	if err != nil || got != 1 || list != 1 || rule != RuleList {
+		t.Errorf("GetNodePriceRule() = %v, %v, %v, %v, want 1, 1, %v, nil", got, list, rule, err, RuleList)
+	}
+}
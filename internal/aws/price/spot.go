@@ -0,0 +1,113 @@
+package price
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+	"github.com/pkg/errors"
+)
+
+// SpotPriceAPI is the EC2 API used to look up spot prices
+type SpotPriceAPI interface {
+	DescribeSpotPriceHistory(ctx context.Context, params *ec2.DescribeSpotPriceHistoryInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error)
+}
+
+type spotPricer struct {
+	client SpotPriceAPI
+	prices *Cache[float64]
+}
+
+// NewSpotPricer returns a NodePricer that uses EC2 spot price history refreshed every ttl
+// in the background till the context is done
+func NewSpotPricer(ctx context.Context, ttl time.Duration) (NodePricer, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading AWS config")
+	}
+	pricer := newSpotPricer(ec2.NewFromConfig(cfg), ttl)
+	go pricer.prices.Run(ctx)
+	return pricer, nil
+}
+
+func newSpotPricer(client SpotPriceAPI, ttl time.Duration) *spotPricer {
+	return &spotPricer{
+		client: client,
+		prices: NewCache[float64]("spot", ttl),
+	}
+}
+
+// GetNodePrice returns the current spot hourly price of the node instance type in the node availability zone
+func (p *spotPricer) GetNodePrice(ctx context.Context, node *usage.NodeInfo) (float64, error) {
+	if node.Zone == "" {
+		return 0, errors.Errorf("node %s has no availability zone", node.Name)
+	}
+	if node.InstanceType == "" {
+		return 0, errors.Errorf("node %s has no instance type", node.Name)
+	}
+	product := getSpotProductDescription(getOSName(node.OS, node.OSImage))
+	// construct key = zone/instance type/product
+	key := fmt.Sprintf("%s/%s/%s", node.Zone, node.InstanceType, product)
+
+	region, zone, instanceType := node.Region, node.Zone, node.InstanceType
+	return p.prices.Get(ctx, key, func(ctx context.Context) (float64, error) {
+		return p.loadSpotPrice(ctx, region, zone, instanceType, product)
+	})
+}
+
+// loadSpotPrice returns the most recent spot price for the instance type in the availability zone
+func (p *spotPricer) loadSpotPrice(ctx context.Context, region, zone, instanceType, product string) (float64, error) {
+	// start time "now" returns the price in effect now
+	input := &ec2.DescribeSpotPriceHistoryInput{
+		AvailabilityZone:    aws.String(zone),
+		InstanceTypes:       []types.InstanceType{types.InstanceType(instanceType)},
+		ProductDescriptions: []string{product},
+		StartTime:           aws.Time(time.Now()),
+	}
+	output, err := p.client.DescribeSpotPriceHistory(ctx, input, func(o *ec2.Options) {
+		if region != "" {
+			o.Region = region
+		}
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "describing spot price history")
+	}
+	var latest *types.SpotPrice
+	for i := range output.SpotPriceHistory {
+		history := &output.SpotPriceHistory[i]
+		if history.SpotPrice == nil || history.Timestamp == nil {
+			continue
+		}
+		if latest == nil || history.Timestamp.After(*latest.Timestamp) {
+			latest = history
+		}
+	}
+	if latest == nil {
+		return 0, errors.Errorf("spot price for %s %s in %s not found", instanceType, product, zone)
+	}
+	price, err := strconv.ParseFloat(*latest.SpotPrice, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "parsing spot price")
+	}
+	return price, nil
+}
+
+// getSpotProductDescription maps the EC2 pricing OS name to the spot product description
+func getSpotProductDescription(osName string) string {
+	switch osName {
+	case "Windows":
+		return "Windows"
+	case "RHEL":
+		return "Red Hat Enterprise Linux"
+	case "SUSE":
+		return "SUSE Linux"
+	default:
+		return "Linux/UNIX"
+	}
+}
@@ -0,0 +1,142 @@
+package price
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+)
+
+// fakeSpotPriceAPI implements SpotPriceAPI interface
+type fakeSpotPriceAPI struct {
+	history []types.SpotPrice
+	calls   int
+	input   *ec2.DescribeSpotPriceHistoryInput
+}
+
+func (f *fakeSpotPriceAPI) DescribeSpotPriceHistory(_ context.Context, params *ec2.DescribeSpotPriceHistoryInput, _ ...func(*ec2.Options)) (*ec2.DescribeSpotPriceHistoryOutput, error) {
+	f.calls++
+	f.input = params
+	return &ec2.DescribeSpotPriceHistoryOutput{SpotPriceHistory: f.history}, nil
+}
+
+// fakeNodePricer implements NodePricer interface
+type fakeNodePricer struct {
+	price float64
+}
+
+func (f *fakeNodePricer) GetNodePrice(_ context.Context, _ *usage.NodeInfo) (float64, error) {
+	return f.price, nil
+}
+
+func TestSpotPricerGetNodePrice(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		history []types.SpotPrice
+		node    *usage.NodeInfo
+		product string
+		want    float64
+		wantErr bool
+	}{
+		{
+			name: "latest Linux spot price",
+			history: []types.SpotPrice{
+				{SpotPrice: aws.String("0.0350"), Timestamp: aws.Time(now.Add(-2 * time.Hour))},
+				{SpotPrice: aws.String("0.0372"), Timestamp: aws.Time(now.Add(-1 * time.Hour))},
+			},
+			node: &usage.NodeInfo{
+				Name:         "node1",
+				Region:       "us-east-1",
+				Zone:         "us-east-1a",
+				InstanceType: "m5.large",
+				OS:           "linux",
+				OSImage:      "Amazon Linux 2",
+			},
+			product: "Linux/UNIX",
+			want:    0.0372,
+		},
+		{
+			name: "Windows spot price",
+			history: []types.SpotPrice{
+				{SpotPrice: aws.String("0.1200"), Timestamp: aws.Time(now)},
+			},
+			node: &usage.NodeInfo{
+				Name:         "node2",
+				Region:       "us-east-1",
+				Zone:         "us-east-1b",
+				InstanceType: "m5.large",
+				OS:           "windows",
+			},
+			product: "Windows",
+			want:    0.12,
+		},
+		{
+			name: "no spot price history",
+			node: &usage.NodeInfo{
+				Name:         "node3",
+				Zone:         "us-east-1c",
+				InstanceType: "m5.large",
+			},
+			wantErr: true,
+		},
+		{
+			name: "node without zone",
+			node: &usage.NodeInfo{
+				Name:         "node4",
+				InstanceType: "m5.large",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeSpotPriceAPI{history: tt.history}
+			pricer := newSpotPricer(client, DefaultSpotPriceTTL)
+			got, err := pricer.GetNodePrice(context.Background(), tt.node)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetNodePrice() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetNodePrice() = %v, want %v", got, tt.want)
+			}
+			if tt.wantErr {
+				return
+			}
+			if *client.input.AvailabilityZone != tt.node.Zone || client.input.ProductDescriptions[0] != tt.product {
+				t.Errorf("DescribeSpotPriceHistory() input = %+v", client.input)
+			}
+			// second lookup is served from the cache
+			_, _ = pricer.GetNodePrice(context.Background(), tt.node)
+			if client.calls != 1 {
+				t.Errorf("DescribeSpotPriceHistory() calls = %d, want 1", client.calls)
+			}
+		})
+	}
+}
+
+func TestNodePricerGetNodePrice(t *testing.T) {
+	pricer := NewNodePricer(&fakeNodePricer{price: 0.096}, &fakeNodePricer{price: 0.035}, &fakeNodePricer{price: 0.012})
+	tests := []struct {
+		computeType  string
+		capacityType string
+		want         float64
+	}{
+		{computeType: "ec2", capacityType: usage.CapacityTypeOnDemand, want: 0.096},
+		{computeType: "ec2", capacityType: usage.CapacityTypeSpot, want: 0.035},
+		{computeType: usage.ComputeTypeFargate, capacityType: usage.CapacityTypeOnDemand, want: 0.012},
+	}
+	for _, tt := range tests {
+		got, err := pricer.GetNodePrice(context.Background(), &usage.NodeInfo{ComputeType: tt.computeType, CapacityType: tt.capacityType})
+		if err != nil {
+			t.Fatalf("GetNodePrice() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("GetNodePrice(%s, %s) = %v, want %v", tt.computeType, tt.capacityType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package price
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+/*
+Storage price table file example (USD per GB-month, per provisioned IOPS-month and per provisioned MiB/s-month),
+merged over the default table:
+
+gp3:
+  gbMonth: 0.08
+  iopsMonth: 0.005
+  freeIOPS: 3000
+  throughputMonth: 0.04
+  freeThroughput: 125
+io2:
+  gbMonth: 0.125
+  iopsMonth: 0.065
+*/
+
+const (
+	// VolumeTypeEFS is the volume type of Amazon EFS volumes; EFS is metered by stored bytes, not by the declared
+	// volume capacity, so EFS volumes are not priced
+	VolumeTypeEFS = "efs"
+	// hours per month used by AWS to convert monthly prices to hourly
+	hoursPerMonth = 730
+)
+
+// StorageRate is the monthly price of volume type
+type StorageRate struct {
+	GBMonth   float64 `json:"gbMonth"`
+	IOPSMonth float64 `json:"iopsMonth,omitempty"`
+	// FreeIOPS are included in the GB-month price (gp3 baseline)
+	FreeIOPS int64 `json:"freeIOPS,omitempty"`
+	// ThroughputMonth is the price of provisioned MiB/s
+	ThroughputMonth float64 `json:"throughputMonth,omitempty"`
+	// FreeThroughput MiB/s are included in the GB-month price (gp3 baseline)
+	FreeThroughput int64 `json:"freeThroughput,omitempty"`
+}
+
+// StoragePrices is the storage price table by EBS volume type: gp2, gp3, io1, io2, st1, sc1 and standard
+type StoragePrices map[string]StorageRate
+
+// DefaultStoragePrices returns the storage price table of us-east-1
+func DefaultStoragePrices() StoragePrices {
+	return StoragePrices{
+		"gp2":      {GBMonth: 0.10},
+		"gp3":      {GBMonth: 0.08, IOPSMonth: 0.005, FreeIOPS: 3000, ThroughputMonth: 0.04, FreeThroughput: 125},
+		"io1":      {GBMonth: 0.125, IOPSMonth: 0.065},
+		"io2":      {GBMonth: 0.125, IOPSMonth: 0.065},
+		"st1":      {GBMonth: 0.045},
+		"sc1":      {GBMonth: 0.015},
+		"standard": {GBMonth: 0.05},
+	}
+}
+
+// LoadStoragePrices loads the storage price table from the YAML file over the default table
+func LoadStoragePrices(file string) (StoragePrices, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading storage prices")
+	}
+	var rates StoragePrices
+	if err = yaml.UnmarshalStrict(data, &rates); err != nil {
+		return nil, errors.Wrap(err, "parsing storage prices")
+	}
+	prices := DefaultStoragePrices()
+	for volumeType, rate := range rates {
+		if volumeType == VolumeTypeEFS {
+			return nil, errors.New("efs volumes are metered by stored bytes and cannot be priced by capacity")
+		}
+		if rate.GBMonth < 0 || rate.IOPSMonth < 0 || rate.FreeIOPS < 0 || rate.ThroughputMonth < 0 || rate.FreeThroughput < 0 {
+			return nil, errors.Errorf("invalid storage price of volume type %s", volumeType)
+		}
+		prices[volumeType] = rate
+	}
+	return prices, nil
+}
+
+// HourlyPrice returns the hourly price of the volume type by size in bytes, provisioned IOPS and provisioned
+// throughput in MiB/s
+func (p StoragePrices) HourlyPrice(volumeType string, size, iops, throughput int64) (float64, bool) {
+	rate, ok := p[volumeType]
+	if !ok {
+		return 0, false
+	}
+	monthly := rate.GBMonth * float64(size) / gibibyte
+	if iops > rate.FreeIOPS {
+		monthly += rate.IOPSMonth * float64(iops-rate.FreeIOPS)
+	}
+	if throughput > rate.FreeThroughput {
+		monthly += rate.ThroughputMonth * float64(throughput-rate.FreeThroughput)
+	}
+	return monthly / hoursPerMonth, true
+}
@@ -0,0 +1,67 @@
+package price
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoragePricesHourlyPrice(t *testing.T) {
+	const epsilon = 1e-9
+	prices := DefaultStoragePrices()
+	tests := []struct {
+		name       string
+		volumeType string
+		size       int64
+		iops       int64
+		throughput int64
+		want       float64
+		wantOK     bool
+	}{
+		{name: "gp2 100GiB", volumeType: "gp2", size: 100 << 30, want: 10.0 / 730, wantOK: true},
+		{name: "gp3 baseline IOPS", volumeType: "gp3", size: 100 << 30, iops: 3000, want: 8.0 / 730, wantOK: true},
+		{name: "gp3 provisioned IOPS", volumeType: "gp3", size: 100 << 30, iops: 4000, want: (8.0 + 1000*0.005) / 730, wantOK: true},
+		{name: "gp3 baseline throughput", volumeType: "gp3", size: 100 << 30, iops: 3000, throughput: 125, want: 8.0 / 730, wantOK: true},
+		{name: "gp3 provisioned throughput", volumeType: "gp3", size: 100 << 30, iops: 3000, throughput: 250, want: (8.0 + 125*0.04) / 730, wantOK: true},
+		{name: "io1 provisioned IOPS", volumeType: "io1", size: 10 << 30, iops: 500, want: (1.25 + 500*0.065) / 730, wantOK: true},
+		{name: "efs not priced", volumeType: VolumeTypeEFS, size: 100 << 30},
+		{name: "unknown volume type", volumeType: "local"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := prices.HourlyPrice(tt.volumeType, tt.size, tt.iops, tt.throughput)
+			if ok != tt.wantOK || math.Abs(got-tt.want) > epsilon {
+				t.Errorf("HourlyPrice() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLoadStoragePrices(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "storage.yaml")
+	if err := os.WriteFile(file, []byte("gp3:\n  gbMonth: 0.0912\n  iopsMonth: 0.0057\n  freeIOPS: 3000\n"), bundleFileMode); err != nil {
+		t.Fatal(err)
+	}
+	prices, err := LoadStoragePrices(file)
+	if err != nil {
+		t.Fatalf("LoadStoragePrices() error = %v", err)
+	}
+	if prices["gp3"].GBMonth != 0.0912 {
+		t.Errorf("LoadStoragePrices() gp3 = %+v, want overridden price", prices["gp3"])
+	}
+	// default prices are kept
+	if prices["gp2"] != DefaultStoragePrices()["gp2"] {
+		t.Errorf("LoadStoragePrices() gp2 = %+v, want default price", prices["gp2"])
+	}
+}
+
+func TestLoadStoragePricesEFS(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "storage.yaml")
+	if err := os.WriteFile(file, []byte("efs:\n  gbMonth: 0.30\n"), bundleFileMode); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadStoragePrices(file); err == nil {
+		t.Error("LoadStoragePrices() error = nil, want error for metered efs volumes")
+	}
+}
@@ -1,6 +1,13 @@
 package config
 
 import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doitintl/eks-lens-agent/internal/aws/price"
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+	"github.com/pkg/errors"
 	"github.com/urfave/cli/v2"
 )
 
@@ -13,15 +20,201 @@ type Config struct {
 	StreamName string `json:"stream-name"`
 	// DevelopMode mode
 	DevelopMode bool `json:"develop-mode"`
-	// Weight Model
-
+	// Weights of the cost model: CPU, memory and GPU unit weights
+	Weights usage.Weights `json:"weights"`
+	// PriceTTL is the time to keep EC2 and Fargate prices before refreshing them
+	PriceTTL time.Duration `json:"price-ttl"`
+	// SpotPriceTTL is the time to keep spot prices before refreshing them
+	SpotPriceTTL time.Duration `json:"spot-price-ttl"`
+	// PricingFile is the path to EC2 pricing file used when AWS price lists are not reachable
+	PricingFile string `json:"pricing-file"`
+	// PricingDir is the path to pricing bundle directory used when AWS price lists are not reachable
+	PricingDir string `json:"pricing-dir"`
+	// PriceOverridesFile is the path to YAML file with discount and custom price rules
+	PriceOverridesFile string `json:"price-overrides"`
+	// CommitmentsFile is the path to YAML file with Reserved Instances and Savings Plans commitments
+	CommitmentsFile string `json:"commitments"`
+	// ClusterFee is the EKS control plane hourly fee of the cluster support tier
+	ClusterFee float64 `json:"cluster-fee"`
+	// SplitClusterFee splits the cluster fee across namespaces
+	SplitClusterFee bool `json:"split-cluster-fee"`
+	// OverheadPolicy is the node system-reserved overhead attribution policy: none, proportional or platform
+	OverheadPolicy string `json:"overhead-policy"`
+	// StoragePricesFile is the path to YAML file with storage prices by volume type
+	StoragePricesFile string `json:"storage-prices"`
+	// LoadBalancerPrices overrides load balancer hourly prices by type
+	LoadBalancerPrices map[string]float64 `json:"lb-prices"`
+	// UsageSource is the pod usage source: metrics (metrics.k8s.io) or kubelet (stats summary), empty to disable
+	UsageSource string `json:"usage-source"`
+	// UsageSamplePeriod is the period of pod usage sampling
+	UsageSamplePeriod time.Duration `json:"usage-sample-period"`
+	// AllocationModel selects the resources the node cost is allocated by: requests, usage, max or blend
+	AllocationModel usage.AllocationModel `json:"allocation-model"`
+	// NamespaceLabels are the namespace labels copied into pod records
+	NamespaceLabels []string `json:"namespace-labels"`
+	// NamespaceAnnotations are the namespace annotations copied into pod records
+	NamespaceAnnotations []string `json:"namespace-annotations"`
+	// MetadataPolicyFile is the path to YAML file with pod, namespace and node labels and annotations capture policy
+	MetadataPolicyFile string `json:"metadata-policy"`
+	// MetricsAddress is the address to serve Prometheus metrics on, empty to disable
+	MetricsAddress string `json:"metrics-address"`
 }
 
-func LoadConfig(c *cli.Context) Config {
+func LoadConfig(c *cli.Context) (Config, error) {
 	var cfg Config
 	cfg.KubeConfigPath = c.String("kubeconfig")
 	cfg.ClusterName = c.String("cluster-name")
 	cfg.StreamName = c.String("stream-name")
 	cfg.DevelopMode = c.Bool("develop-mode")
-	return cfg
+	cfg.PriceTTL = c.Duration("price-ttl")
+	cfg.SpotPriceTTL = c.Duration("spot-price-ttl")
+	cfg.PricingFile = c.String("pricing-file")
+	cfg.PricingDir = c.String("pricing-dir")
+	cfg.PriceOverridesFile = c.String("price-overrides")
+	cfg.CommitmentsFile = c.String("commitments")
+	cfg.StoragePricesFile = c.String("storage-prices")
+	cfg.MetricsAddress = c.String("metrics-address")
+	cfg.NamespaceLabels = c.StringSlice("namespace-label")
+	cfg.NamespaceAnnotations = c.StringSlice("namespace-annotation")
+	cfg.MetadataPolicyFile = c.String("metadata-policy")
+	cfg.OverheadPolicy = c.String("overhead-policy")
+	switch cfg.OverheadPolicy {
+	case usage.OverheadPolicyNone, usage.OverheadPolicyProportional, usage.OverheadPolicyPlatform:
+	default:
+		return cfg, errors.Errorf("invalid overhead policy %q", cfg.OverheadPolicy)
+	}
+	// EKS control plane fee of the cluster Kubernetes version support tier
+	switch support := c.String("eks-support"); support {
+	case "standard":
+		cfg.ClusterFee = c.Float64("eks-standard-support-fee")
+	case "extended":
+		cfg.ClusterFee = c.Float64("eks-extended-support-fee")
+	default:
+		return cfg, errors.Errorf("invalid EKS support %q, expected standard or extended", support)
+	}
+	cfg.SplitClusterFee = c.Bool("split-cluster-fee")
+	cfg.UsageSource = c.String("usage-source")
+	cfg.UsageSamplePeriod = c.Duration("usage-sample-period")
+	switch cfg.UsageSource {
+	case "", "metrics", "kubelet":
+	default:
+		return cfg, errors.Errorf("invalid usage source %q, expected metrics or kubelet", cfg.UsageSource)
+	}
+	if cfg.UsageSource != "" && cfg.UsageSamplePeriod <= 0 {
+		return cfg, errors.New("usage sample period must be positive")
+	}
+	cfg.AllocationModel = usage.AllocationModel{
+		Name:        c.String("allocation-model"),
+		UsageWeight: c.Float64("usage-weight"),
+	}
+	switch cfg.AllocationModel.Name {
+	case usage.AllocationModelRequests:
+	case usage.AllocationModelUsage, usage.AllocationModelMax, usage.AllocationModelBlend:
+		if cfg.UsageSource == "" {
+			return cfg, errors.Errorf("allocation model %q requires usage source", cfg.AllocationModel.Name)
+		}
+	default:
+		return cfg, errors.Errorf("invalid allocation model %q, expected requests, usage, max or blend", cfg.AllocationModel.Name)
+	}
+	if cfg.AllocationModel.UsageWeight < 0 || cfg.AllocationModel.UsageWeight > 1 {
+		return cfg, errors.New("usage weight must be between 0 and 1")
+	}
+	if cfg.PriceTTL <= 0 || cfg.SpotPriceTTL <= 0 {
+		return cfg, errors.New("price TTL must be positive")
+	}
+	if cfg.PricingFile != "" && cfg.PricingDir != "" {
+		return cfg, errors.New("pricing file and pricing directory are mutually exclusive")
+	}
+	// cost model weights: defaults overridden by flags
+	cfg.Weights = usage.DefaultWeights()
+	if c.IsSet("cpu-weight") {
+		cfg.Weights.CPU = c.Float64("cpu-weight")
+	}
+	if c.IsSet("memory-weight") {
+		cfg.Weights.Memory = c.Float64("memory-weight")
+	}
+	if c.IsSet("default-gpu-weight") {
+		cfg.Weights.DefaultGPU = c.Float64("default-gpu-weight")
+	}
+	for _, value := range c.StringSlice("gpu-weight") {
+		family, weight, err := parseGPUWeight(value)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Weights.GPU[family] = weight
+	}
+	weighted := make(map[string]bool)
+	for _, value := range c.StringSlice("extended-resource-weight") {
+		name, weight, err := parseExtendedRate(value)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Weights.Extended[name] = usage.ExtendedRate{Weight: weight}
+		weighted[name] = true
+	}
+	for _, value := range c.StringSlice("extended-resource-price") {
+		name, hourly, err := parseExtendedRate(value)
+		if err != nil {
+			return cfg, err
+		}
+		if weighted[name] {
+			return cfg, errors.Errorf("extended resource %s has both a weight and a price", name)
+		}
+		cfg.Weights.Extended[name] = usage.ExtendedRate{Price: hourly}
+	}
+	cfg.LoadBalancerPrices = make(map[string]float64)
+	for _, value := range c.StringSlice("lb-price") {
+		lbType, hourly, err := parseLoadBalancerPrice(value)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.LoadBalancerPrices[lbType] = hourly
+	}
+	return cfg, nil
+}
+
+// parseLoadBalancerPrice parses load balancer hourly price in "type=price" format, e.g. "nlb=0.0252"
+func parseLoadBalancerPrice(value string) (string, float64, error) {
+	lbType, hourly, ok := strings.Cut(value, "=")
+	if !ok || lbType == "" {
+		return "", 0, errors.Errorf("invalid load balancer price %q, expected type=price", value)
+	}
+	if _, ok = price.DefaultLoadBalancerPrices()[lbType]; !ok {
+		return "", 0, errors.Errorf("invalid load balancer type %s, expected clb or nlb", lbType)
+	}
+	p, err := strconv.ParseFloat(hourly, 64)
+	if err != nil || p < 0 {
+		return "", 0, errors.Errorf("invalid hourly price %q for load balancer type %s", hourly, lbType)
+	}
+	return lbType, p, nil
+}
+
+// parseExtendedRate parses extended resource weight or hourly price in "resource=value" format,
+// e.g. "aws.amazon.com/neuron=250"
+func parseExtendedRate(value string) (string, float64, error) {
+	name, rate, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return "", 0, errors.Errorf("invalid extended resource rate %q, expected resource=value", value)
+	}
+	r, err := strconv.ParseFloat(rate, 64)
+	if err != nil || r < 0 {
+		return "", 0, errors.Errorf("invalid rate %q for extended resource %s", rate, name)
+	}
+	if name == usage.ResourceGPU {
+		return "", 0, errors.Errorf("%s is charged by GPU weights", name)
+	}
+	return name, r, nil
+}
+
+// parseGPUWeight parses GPU weight in "family=weight" format, e.g. "g5=200"
+func parseGPUWeight(value string) (string, float64, error) {
+	family, weight, ok := strings.Cut(value, "=")
+	if !ok || family == "" {
+		return "", 0, errors.Errorf("invalid GPU weight %q, expected family=weight", value)
+	}
+	w, err := strconv.ParseFloat(weight, 64)
+	if err != nil || w < 0 {
+		return "", 0, errors.Errorf("invalid GPU weight %q for instance family %s", weight, family)
+	}
+	return family, w, nil
 }
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/doitintl/eks-lens-agent/internal/aws/firehose"
@@ -11,6 +12,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
@@ -29,21 +31,53 @@ type Scanner interface {
 	Run(ctx context.Context) error
 }
 
+// Options configures the records produced by the scanner
+type Options struct {
+	// OverheadPolicy is the node overhead attribution policy: none, proportional or platform
+	OverheadPolicy string
+	// ClusterName is the name of the EKS cluster
+	ClusterName string
+	// ClusterFee is the EKS control plane hourly fee, zero to skip the cluster fee record
+	ClusterFee float64
+	// SplitClusterFee splits the cluster fee across namespaces proportionally to their requested resources cost
+	SplitClusterFee bool
+	// Usage collects actual pod resources usage, nil when usage collection is disabled
+	Usage *UsageCollector
+	// Owners resolves pod workload owners, nil to skip owner resolution
+	Owners OwnersInformer
+	// Metadata selects the pod labels and annotations, nil for the default policy
+	Metadata *usage.MetadataPolicy
+	// Namespaces copies namespace labels and annotations into pod records, nil to skip namespace metadata
+	Namespaces NamespacesInformer
+	// AllocationModel selects the resources the node cost is allocated by: requests, usage or both
+	AllocationModel usage.AllocationModel
+}
+
 type scanner struct {
 	log          *logrus.Entry
 	client       *kubernetes.Clientset
 	uploader     firehose.Uploader
 	nodeInformer NodesInformer
-	deletedPods  []*usage.PodInfo
+	options      Options
+	sources      []RecordsSource
+	intervals    *reportedIntervals
+	// mu guards deletedPods and deletedPodObjects: pods are deleted by the pod informer while records are uploaded
+	mu          sync.Mutex
+	deletedPods []*usage.PodInfo
+	// deleted pods of the records, e.g. for the volume claims they consumed
+	deletedPodObjects []*v1.Pod
 }
 
-func New(log *logrus.Entry, client *kubernetes.Clientset, uploader firehose.Uploader, informer NodesInformer) Scanner {
+func New(log *logrus.Entry, client *kubernetes.Clientset, uploader firehose.Uploader, informer NodesInformer, options Options, sources ...RecordsSource) Scanner {
 	return &scanner{
 		log:          log,
 		client:       client,
 		uploader:     uploader,
 		nodeInformer: informer,
+		options:      options,
+		sources:      sources,
 		deletedPods:  make([]*usage.PodInfo, 0),
+		intervals:    newReportedIntervals(syncPeriod),
 	}
 }
 
@@ -53,6 +87,9 @@ func (s *scanner) DeletePod(obj interface{}) {
 		"namespace": pod.Namespace,
 		"name":      pod.Name,
 	}).Debug("pod deleted")
+	// the final pod record covers the time since the pod was last reported
+	now := time.Now()
+	beginTime := s.intervals.final(pod.UID, now)
 	// skip "Failed" pods (e.g. DaemonSet pods on Fargate)
 	if pod.Status.Phase == v1.PodFailed {
 		s.log.WithFields(logrus.Fields{
@@ -63,19 +100,60 @@ func (s *scanner) DeletePod(obj interface{}) {
 		return
 	}
 	// get the node info from the cache
-	node, ok := s.nodeInformer.GetNode(pod.Spec.NodeName)
+	node, ok, err := s.nodeInformer.GetPodNode(context.Background(), pod)
 	if !ok {
 		s.log.Warnf("failed to get node %s from cache", pod.Spec.NodeName)
 	}
+	if err != nil {
+		s.log.WithError(err).WithField("node", pod.Spec.NodeName).Warn("failed to price pod node")
+	}
+	// the pod may have stopped running before it was deleted, e.g. completed Jobs or pods stuck terminating
+	endTime := usage.GetPodEndTime(pod, now)
+	if !endTime.After(beginTime) {
+		s.log.WithFields(logrus.Fields{
+			"namespace": pod.Namespace,
+			"name":      pod.Name,
+		}).Debug("skipped pod stopped before it was last reported")
+		return
+	}
 	// convert PodInfo to usage record
-	now := time.Now()
-	beginTime := now.Add(-syncPeriod)
-	record := usage.GetPodInfo(s.log, pod, beginTime, now, node)
+	record := usage.GetPodInfo(s.log, pod, beginTime, endTime, node, s.options.Metadata)
+	if s.options.Usage != nil {
+		record.Usage = s.options.Usage.Take(pod.UID)
+	}
+	s.options.AllocationModel.Apply(record)
+	if s.options.Owners != nil {
+		s.options.Owners.SetOwners(record, pod)
+	}
+	if s.options.Namespaces != nil {
+		s.options.Namespaces.SetMetadata(record)
+	}
 	// keep the record till the next sync period
+	s.mu.Lock()
 	s.deletedPods = append(s.deletedPods, record)
+	s.deletedPodObjects = append(s.deletedPodObjects, pod)
+	s.mu.Unlock()
+}
+
+// takeDeletedPods returns the records and the pods deleted since the last upload and clears the lists
+func (s *scanner) takeDeletedPods() ([]*usage.PodInfo, []*v1.Pod) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted, pods := s.deletedPods, s.deletedPodObjects
+	s.deletedPods = make([]*usage.PodInfo, 0)
+	s.deletedPodObjects = nil
+	return deleted, pods
 }
 
 func (s *scanner) Run(ctx context.Context) error {
+	// define sync period
+	tick := syncPeriod
+	// get develop-mode mode from context
+	if val := ctx.Value(developModeKey); val != nil && val.(bool) {
+		tick = syncPeriodDebug
+	}
+	s.intervals = newReportedIntervals(tick)
+
 	// Create a new PodInfo shared informer
 	podInformer := cache.NewSharedIndexInformer(
 		&cache.ListWatch{
@@ -85,6 +163,8 @@ func (s *scanner) Run(ctx context.Context) error {
 				return s.client.CoreV1().Pods("").List(context.Background(), options) //nolint:wrapcheck
 			},
 			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				// pods leaving the Running phase are watched as deleted
+				options.FieldSelector = "status.phase=Running"
 				return s.client.CoreV1().Pods("").Watch(context.Background(), options) //nolint:wrapcheck
 			},
 			DisableChunking: true,
@@ -110,46 +190,13 @@ func (s *scanner) Run(ctx context.Context) error {
 		return errors.New("failed to sync cache")
 	}
 
-	// define sync period
-	tick := syncPeriod
-	// get develop-mode mode from context
-	if val := ctx.Value(developModeKey); val != nil && val.(bool) {
-		tick = syncPeriodDebug
+	// start sampling pod usage
+	if s.options.Usage != nil {
+		go s.options.Usage.Run(ctx, s.log, podInformer.GetStore())
 	}
 
-	// upload function
-	upload := func() {
-		// get the list of pods from the cache
-		pods := podInformer.GetStore().List()
-		// convert PodInfo to usage record
-		now := time.Now()
-		beginTime := now.Add(-syncPeriod)
-		records := make([]*usage.PodInfo, 0, len(pods))
-		for _, obj := range pods {
-			pod := obj.(*v1.Pod)
-			// get the node info from the cache
-			node, ok := s.nodeInformer.GetNode(pod.Spec.NodeName)
-			if !ok {
-				s.log.Warnf("getting node %s from cache", pod.Spec.NodeName)
-			}
-			record := usage.GetPodInfo(s.log, pod, beginTime, now, node)
-			records = append(records, record)
-		}
-		// add deleted pods and clear the list if any
-		if len(s.deletedPods) > 0 {
-			s.log.WithField("count", len(s.deletedPods)).Debug("adding deleted pods to the pod records")
-			records = append(records, s.deletedPods...)
-			s.deletedPods = make([]*usage.PodInfo, 0)
-		}
-		// upload the records to EKS Lens
-		s.log.WithField("count", len(records)).Debug("uploading pod records to EKS Lens")
-		err = s.uploader.Upload(ctx, records)
-		if err != nil {
-			s.log.WithError(err).Error("uploading pods records to EKS Lens")
-		}
-	}
 	// upload first time
-	upload()
+	s.upload(ctx, podInformer.GetStore().List())
 
 	// get pod list from the cache every "syncPeriod/DevelopMode" minutes
 	ticker := time.NewTicker(tick)
@@ -159,7 +206,171 @@ func (s *scanner) Run(ctx context.Context) error {
 		case <-ctx.Done():
 			return nil
 		case <-ticker.C:
-			upload()
+			s.upload(ctx, podInformer.GetStore().List())
+		}
+	}
+}
+
+// upload uploads the records of the interval ending now to EKS Lens
+func (s *scanner) upload(ctx context.Context, pods []interface{}) {
+	records := s.getRecords(ctx, pods, time.Now())
+	s.log.WithField("count", len(records)).Debug("uploading pod records to EKS Lens")
+	if err := s.uploader.Upload(ctx, records); err != nil {
+		s.log.WithError(err).Error("uploading pods records to EKS Lens")
+	}
+}
+
+// getRecords returns the records of the interval ending now: running and deleted pods, idle capacity,
+// node overhead, cluster fee and other cluster resources records
+func (s *scanner) getRecords(ctx context.Context, pods []interface{}, now time.Time) []*usage.PodInfo {
+	beginTime := s.intervals.begin(now)
+	records := make([]*usage.PodInfo, 0, len(pods))
+	// pods running or deleted during the interval
+	reported := make([]*v1.Pod, 0, len(pods))
+	runningUIDs := make(map[types.UID]bool, len(pods))
+	// pods usage sampled since the last upload
+	var podsUsage map[types.UID]*usage.ResourceUsage
+	if s.options.Usage != nil {
+		podsUsage = s.options.Usage.Collect()
+	}
+	for _, obj := range pods {
+		pod := obj.(*v1.Pod)
+		runningUIDs[pod.UID] = true
+		// the store holds running pods only: pods that stop running (e.g. completed Jobs) or are deleted leave it
+		// through a DELETE event, DeletePod keeps their final record and next skips them; terminating pods stay
+		// running till their containers stop, report them till they stopped
+		endTime := usage.GetPodEndTime(pod, now)
+		// each pod record starts where the previous one ended
+		podBeginTime, ok := s.intervals.next(pod.UID, now, endTime)
+		if !ok {
+			// the pod is deleted and its final record is already kept
+			continue
+		}
+		if !endTime.After(podBeginTime) {
+			// the pod stopped before the interval
+			continue
+		}
+		reported = append(reported, pod)
+		// get the node info from the cache
+		node, ok, err := s.nodeInformer.GetPodNode(ctx, pod)
+		if !ok {
+			s.log.Warnf("getting node %s from cache", pod.Spec.NodeName)
+		}
+		if err != nil {
+			s.log.WithError(err).WithField("node", pod.Spec.NodeName).Warn("pricing pod node")
+		}
+		record := usage.GetPodInfo(s.log, pod, podBeginTime, endTime, node, s.options.Metadata)
+		record.Usage = podsUsage[pod.UID]
+		s.options.AllocationModel.Apply(record)
+		if s.options.Owners != nil {
+			s.options.Owners.SetOwners(record, pod)
+		}
+		if s.options.Namespaces != nil {
+			s.options.Namespaces.SetMetadata(record)
+		}
+		records = append(records, record)
+	}
+	// add deleted pods and clear the list if any; deleted pods take node capacity from idle and share the node
+	// overhead and the cluster fee
+	deleted, deletedPods := s.takeDeletedPods()
+	if len(deleted) > 0 {
+		s.log.WithField("count", len(deleted)).Debug("adding deleted pods to the pod records")
+		records = append(records, deleted...)
+		reported = append(reported, deletedPods...)
+	}
+	nodes := s.nodeInformer.GetNodes()
+	nodePods := nodePodRecords(records)
+	// allocation by usage can exceed the node allocatable
+	for i := range nodes {
+		usage.NormalizeAllocated(&nodes[i], nodePods[nodes[i].Name], beginTime, now)
+	}
+	// add idle capacity and node overhead records
+	records = append(records, idleRecords(nodes, nodePods, beginTime, now)...)
+	records = append(records, overheadRecords(s.options.OverheadPolicy, nodes, nodePods, beginTime, now)...)
+	records = append(records, s.clusterFeeRecords(records, beginTime, now)...)
+	// add records of other cluster resources, e.g. persistent volumes consumed by the reported pods
+	for _, source := range s.sources {
+		records = append(records, source.GetRecords(reported, beginTime, now)...)
+	}
+	s.intervals.uploaded(now, runningUIDs)
+	// identify records for removing duplicates downstream
+	for _, record := range records {
+		record.SetRecordID(s.options.ClusterName)
+	}
+	return records
+}
+
+// nodePodRecords returns the pod records per node name
+func nodePodRecords(records []*usage.PodInfo) map[string][]*usage.PodInfo {
+	nodePods := make(map[string][]*usage.PodInfo)
+	for _, record := range records {
+		if record.RecordType == usage.RecordTypePod {
+			nodePods[record.Node.Name] = append(nodePods[record.Node.Name], record)
+		}
+	}
+	return nodePods
+}
+
+// idleRecords returns idle capacity records of EC2 nodes: node allocatable resources not allocated to the node pod
+// records over the interval; Fargate pods are billed for the whole Fargate node
+func idleRecords(nodes []usage.NodeInfo, nodePods map[string][]*usage.PodInfo, beginTime, endTime time.Time) []*usage.PodInfo {
+	idle := make([]*usage.PodInfo, 0, len(nodes))
+	for i := range nodes {
+		node := &nodes[i]
+		if node.ComputeType == usage.ComputeTypeFargate {
+			continue
+		}
+		idle = append(idle, usage.GetNodeIdleInfo(node, nodePods[node.Name], beginTime, endTime))
+	}
+	return idle
+}
+
+// overheadRecords attributes EC2 nodes overhead by the policy: spreads it across the node pod records
+// or returns overhead records for nodes without pods to spread it across
+func overheadRecords(policy string, nodes []usage.NodeInfo, nodePods map[string][]*usage.PodInfo, beginTime, endTime time.Time) []*usage.PodInfo {
+	if policy != usage.OverheadPolicyProportional && policy != usage.OverheadPolicyPlatform {
+		return nil
+	}
+	overhead := make([]*usage.PodInfo, 0, len(nodes))
+	for i := range nodes {
+		node := &nodes[i]
+		if node.ComputeType == usage.ComputeTypeFargate || usage.GetNodeOverhead(node).IsZero() {
+			continue
+		}
+		record := usage.GetOverheadInfo(node, beginTime, endTime)
+		if policy == usage.OverheadPolicyProportional && usage.SpreadOverhead(record.Cost.Total, nodePods[node.Name]) {
+			continue
+		}
+		overhead = append(overhead, record)
+	}
+	return overhead
+}
+
+// clusterFeeRecords returns the EKS control plane fee record or, when split, the namespace shares of the fee
+// proportional to the namespace pods requested resources cost
+func (s *scanner) clusterFeeRecords(records []*usage.PodInfo, beginTime, endTime time.Time) []*usage.PodInfo {
+	if s.options.ClusterFee <= 0 {
+		return nil
+	}
+	if s.options.SplitClusterFee {
+		namespaceCost := make(map[string]float64)
+		var total float64
+		for _, record := range records {
+			if record.RecordType == usage.RecordTypePod {
+				cost := record.Cost.CPU + record.Cost.Memory + record.Cost.GPU + record.Cost.Extended
+				namespaceCost[record.Namespace] += cost
+				total += cost
+			}
+		}
+		if total > 0 {
+			fees := make([]*usage.PodInfo, 0, len(namespaceCost))
+			for namespace, cost := range namespaceCost {
+				if cost > 0 {
+					fees = append(fees, usage.GetClusterFeeInfo(s.options.ClusterName, namespace, s.options.ClusterFee, cost/total, beginTime, endTime))
+				}
+			}
+			return fees
 		}
 	}
+	return []*usage.PodInfo{usage.GetClusterFeeInfo(s.options.ClusterName, "", s.options.ClusterFee, 1, beginTime, endTime)}
 }
@@ -0,0 +1,403 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestIdleRecords(t *testing.T) {
+	nodes := []usage.NodeInfo{
+		{Name: "node1", Allocatable: usage.Capacity{CPU: 2000, Memory: 4 << 30}},
+		{Name: "fargate-ip-192-168-1-1", ComputeType: usage.ComputeTypeFargate, Allocatable: usage.Capacity{CPU: 250}},
+	}
+	now := time.Now()
+	pods := []*usage.PodInfo{{
+		RecordType: usage.RecordTypePod,
+		Node:       nodes[0],
+		BeginTime:  now.Add(-syncPeriod),
+		EndTime:    now,
+		Resources:  usage.Resources{Allocated: usage.Ask{CPU: 500, Memory: 1 << 30}},
+	}}
+
+	records := idleRecords(nodes, nodePodRecords(pods), now.Add(-syncPeriod), now)
+
+	// one idle record per EC2 node
+	assert.Len(t, records, 1)
+	assert.Equal(t, usage.IdleNamespace, records[0].Namespace)
+	assert.Equal(t, "node1", records[0].Node.Name)
+	assert.Equal(t, usage.Ask{CPU: 1500, Memory: 3 << 30}, records[0].Resources.Requests)
+}
+
+func TestOverheadRecords(t *testing.T) {
+	nodes := []usage.NodeInfo{
+		{
+			Name:        "node1",
+			Capacity:    usage.Capacity{CPU: 2000, Memory: 4 << 30},
+			Allocatable: usage.Capacity{CPU: 1930, Memory: 3 << 30},
+			Cost:        usage.Cost{VCPUHour: 0.04, MemoryHour: 0.005},
+		},
+		{
+			Name:        "node2",
+			Capacity:    usage.Capacity{CPU: 2000, Memory: 4 << 30},
+			Allocatable: usage.Capacity{CPU: 1930, Memory: 3 << 30},
+			Cost:        usage.Cost{VCPUHour: 0.04, MemoryHour: 0.005},
+		},
+	}
+	now := time.Now()
+	newRecords := func() []*usage.PodInfo {
+		return []*usage.PodInfo{
+			{RecordType: usage.RecordTypePod, Node: nodes[0], Cost: usage.PodCost{CPU: 0.01, Total: 0.01}},
+			{RecordType: usage.RecordTypeIdle, Node: nodes[0], Cost: usage.PodCost{CPU: 0.02, Total: 0.02}},
+		}
+	}
+
+	// no overhead attribution
+	assert.Empty(t, overheadRecords(usage.OverheadPolicyNone, nodes, nodePodRecords(newRecords()), now.Add(-syncPeriod), now))
+
+	// overhead record per node
+	records := newRecords()
+	overhead := overheadRecords(usage.OverheadPolicyPlatform, nodes, nodePodRecords(records), now.Add(-syncPeriod), now)
+	assert.Len(t, overhead, 2)
+	assert.Equal(t, usage.OverheadNamespace, overhead[0].Namespace)
+	assert.Zero(t, records[0].Cost.NodeOverhead)
+
+	// overhead spread across node1 pods, overhead record for node2 without pods
+	records = newRecords()
+	overhead = overheadRecords(usage.OverheadPolicyProportional, nodes, nodePodRecords(records), now.Add(-syncPeriod), now)
+	assert.Len(t, overhead, 1)
+	assert.Equal(t, "node2", overhead[0].Node.Name)
+	assert.Positive(t, records[0].Cost.NodeOverhead)
+	assert.Zero(t, records[1].Cost.NodeOverhead)
+}
+
+func TestClusterFeeRecords(t *testing.T) {
+	const epsilon = 1e-9
+	now := time.Now()
+	beginTime := now.Add(-30 * time.Minute)
+	records := []*usage.PodInfo{
+		{RecordType: usage.RecordTypePod, Namespace: "team-a", Cost: usage.PodCost{CPU: 0.3, Total: 0.3}},
+		{RecordType: usage.RecordTypePod, Namespace: "team-a", Cost: usage.PodCost{Memory: 0.3, Total: 0.3}},
+		{RecordType: usage.RecordTypePod, Namespace: "team-b", Cost: usage.PodCost{CPU: 0.2, Total: 0.2}},
+		{RecordType: usage.RecordTypeIdle, Namespace: usage.IdleNamespace, Cost: usage.PodCost{CPU: 1, Total: 1}},
+	}
+
+	// cluster fee record
+	s := &scanner{options: Options{ClusterName: "test-cluster", ClusterFee: 0.1}}
+	fees := s.clusterFeeRecords(records, beginTime, now)
+	assert.Len(t, fees, 1)
+	assert.Equal(t, usage.ClusterFeeNamespace, fees[0].Namespace)
+	assert.Equal(t, "test-cluster", fees[0].Node.Cluster)
+	assert.InDelta(t, 0.05, fees[0].Cost.Total, epsilon)
+
+	// fee split across namespaces by pods requested resources cost
+	s.options.SplitClusterFee = true
+	fees = s.clusterFeeRecords(records, beginTime, now)
+	assert.Len(t, fees, 2)
+	shares := make(map[string]float64)
+	for _, fee := range fees {
+		assert.Equal(t, usage.RecordTypeClusterFee, fee.RecordType)
+		shares[fee.Namespace] = fee.Cost.ClusterFee
+	}
+	assert.InDelta(t, 0.05*0.75, shares["team-a"], epsilon)
+	assert.InDelta(t, 0.05*0.25, shares["team-b"], epsilon)
+
+	// no fee
+	s.options.ClusterFee = 0
+	assert.Empty(t, s.clusterFeeRecords(records, beginTime, now))
+}
+
+func TestGetRecordsDeletedPods(t *testing.T) {
+	const epsilon = 1e-9
+	node := usage.NodeInfo{
+		Name:        "node1",
+		Capacity:    usage.Capacity{CPU: 2000, Memory: 4 << 30},
+		Allocatable: usage.Capacity{CPU: 1000, Memory: 4 << 30},
+		Cost:        usage.Cost{VCPUHour: 0.04, MemoryHour: 0.005},
+	}
+	now := time.Now()
+	beginTime := now.Add(-syncPeriod)
+	s := &scanner{
+		log:          logrus.NewEntry(logrus.New()),
+		nodeInformer: &NodesMap{data: map[string]usage.NodeInfo{node.Name: node}},
+		options: Options{
+			OverheadPolicy:  usage.OverheadPolicyProportional,
+			ClusterFee:      0.1,
+			SplitClusterFee: true,
+		},
+		intervals: newReportedIntervals(syncPeriod),
+	}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "running", Namespace: "team-a", UID: "uid-running"},
+		Spec: v1.PodSpec{
+			NodeName:   node.Name,
+			Containers: []v1.Container{{Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")}}}},
+		},
+	}
+	// pod deleted during the interval, with the same cost as the running pod
+	deleted := &usage.PodInfo{
+		Name:       "deleted",
+		Namespace:  "team-b",
+		RecordType: usage.RecordTypePod,
+		Node:       node,
+		BeginTime:  beginTime,
+		EndTime:    now,
+		Resources:  usage.Resources{Requests: usage.Ask{CPU: 500}, Allocated: usage.Ask{CPU: 500}},
+	}
+	deleted.Cost = usage.GetPodCost(deleted.Resources.Allocated, node.Cost, beginTime, now)
+	s.deletedPods = []*usage.PodInfo{deleted}
+
+	records := s.getRecords(context.Background(), []interface{}{pod}, now)
+
+	// deleted pods share the cluster fee and the node overhead
+	fees := make(map[string]float64)
+	for _, record := range records {
+		if record.RecordType == usage.RecordTypeClusterFee {
+			fees[record.Namespace] = record.Cost.ClusterFee
+		}
+	}
+	assert.InDelta(t, fees["team-a"], fees["team-b"], epsilon)
+	assert.Positive(t, deleted.Cost.NodeOverhead)
+	assert.Empty(t, s.deletedPods)
+}
+
+func TestDeletePodConcurrentUpload(t *testing.T) {
+	const deletes = 50
+	node := usage.NodeInfo{Name: "node1", Allocatable: usage.Capacity{CPU: 2000, Memory: 4 << 30}}
+	s := &scanner{
+		log:          logrus.NewEntry(logrus.New()),
+		nodeInformer: &NodesMap{data: map[string]usage.NodeInfo{node.Name: node}},
+		intervals:    newReportedIntervals(syncPeriod),
+	}
+	// pods are deleted by the pod informer while records are uploaded
+	var wg sync.WaitGroup
+	for i := 0; i < deletes; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.DeletePod(&v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pod-%d", i), Namespace: "default", UID: types.UID(fmt.Sprintf("uid-%d", i))},
+				Spec:       v1.PodSpec{NodeName: node.Name},
+			})
+		}(i)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	var uploaded int
+	count := func() {
+		for _, record := range s.getRecords(context.Background(), nil, time.Now()) {
+			if record.RecordType == usage.RecordTypePod {
+				uploaded++
+			}
+		}
+	}
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			count()
+		}
+	}
+	count()
+
+	// every deleted pod record is uploaded exactly once
+	assert.Equal(t, deletes, uploaded)
+}
+
+func TestGetRecordsStoppedPod(t *testing.T) {
+	node := usage.NodeInfo{
+		Name:        "node1",
+		Allocatable: usage.Capacity{CPU: 2000, Memory: 4 << 30},
+		Cost:        usage.Cost{VCPUHour: 0.04, MemoryHour: 0.005},
+	}
+	now := time.Now()
+	finished := now.Add(-10 * time.Minute)
+	s := &scanner{
+		log:          logrus.NewEntry(logrus.New()),
+		nodeInformer: &NodesMap{data: map[string]usage.NodeInfo{node.Name: node}},
+		intervals:    newReportedIntervals(syncPeriod),
+		deletedPods:  make([]*usage.PodInfo, 0),
+	}
+	// completed Job pod still in the pod store, e.g. listed before its phase change is watched
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "default", UID: "uid-job"},
+		Spec: v1.PodSpec{
+			NodeName:   node.Name,
+			Containers: []v1.Container{{Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")}}}},
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodSucceeded,
+			ContainerStatuses: []v1.ContainerStatus{{
+				State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{FinishedAt: metav1.Time{Time: finished}}},
+			}},
+		},
+	}
+	podRecords := func(records []*usage.PodInfo) []*usage.PodInfo {
+		var result []*usage.PodInfo
+		for _, record := range records {
+			if record.RecordType == usage.RecordTypePod {
+				result = append(result, record)
+			}
+		}
+		return result
+	}
+
+	// the pod record ends when the pod stopped
+	records := podRecords(s.getRecords(context.Background(), []interface{}{pod}, now))
+	assert.Len(t, records, 1)
+	assert.Equal(t, finished, records[0].EndTime)
+
+	// the stopped pod is not reported again
+	next := now.Add(syncPeriod)
+	assert.Empty(t, podRecords(s.getRecords(context.Background(), []interface{}{pod}, next)))
+
+	// nor when it is deleted
+	s.DeletePod(pod)
+	assert.Empty(t, s.deletedPods)
+}
+
+// fakeRecordsSource records the pods it gets records for
+type fakeRecordsSource struct {
+	pods []*v1.Pod
+}
+
+func (f *fakeRecordsSource) GetRecords(pods []*v1.Pod, _, _ time.Time) []*usage.PodInfo {
+	f.pods = pods
+	return nil
+}
+
+func TestGetRecordsSourcesDeletedPods(t *testing.T) {
+	node := usage.NodeInfo{Name: "node1", Allocatable: usage.Capacity{CPU: 2000, Memory: 4 << 30}}
+	source := &fakeRecordsSource{}
+	s := &scanner{
+		log:          logrus.NewEntry(logrus.New()),
+		nodeInformer: &NodesMap{data: map[string]usage.NodeInfo{node.Name: node}},
+		intervals:    newReportedIntervals(syncPeriod),
+		sources:      []RecordsSource{source},
+		deletedPods:  make([]*usage.PodInfo, 0),
+	}
+	running := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "db-1", Namespace: "default", UID: "uid-db-1"},
+		Spec:       v1.PodSpec{NodeName: node.Name},
+	}
+	deleted := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "db-0", Namespace: "default", UID: "uid-db-0"},
+		Spec:       v1.PodSpec{NodeName: node.Name},
+	}
+	s.DeletePod(deleted)
+
+	// pods deleted during the interval are passed to sources, e.g. as volume claim consumers
+	s.getRecords(context.Background(), []interface{}{running}, time.Now())
+	assert.ElementsMatch(t, []*v1.Pod{running, deleted}, source.pods)
+
+	// deleted pods are passed once
+	s.getRecords(context.Background(), []interface{}{running}, time.Now())
+	assert.Equal(t, []*v1.Pod{running}, source.pods)
+}
+
+func TestGetRecordsIdleReconciles(t *testing.T) {
+	const instanceHour = 0.096
+	allocatable := usage.Capacity{CPU: 2000, Memory: 8 << 30}
+	node := usage.NodeInfo{
+		Name:        "node1",
+		Capacity:    allocatable,
+		Allocatable: allocatable,
+		Cost:        usage.NewCost(instanceHour, "m5.large", allocatable, usage.DefaultWeights()),
+	}
+	now := time.Now()
+	beginTime := now.Add(-syncPeriod)
+	s := &scanner{
+		log:          logrus.NewEntry(logrus.New()),
+		nodeInformer: &NodesMap{data: map[string]usage.NodeInfo{node.Name: node}},
+		intervals:    newReportedIntervals(syncPeriod),
+	}
+	requests := v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("2Gi")}
+	// pod started during the interval
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "started", Namespace: "default", UID: "uid-started"},
+		Spec:       v1.PodSpec{NodeName: node.Name, Containers: []v1.Container{{Resources: v1.ResourceRequirements{Requests: requests}}}},
+		Status:     v1.PodStatus{StartTime: &metav1.Time{Time: now.Add(-5 * time.Minute)}},
+	}
+	// pod deleted during the interval
+	deleted := &usage.PodInfo{
+		Name:       "deleted",
+		Namespace:  "default",
+		RecordType: usage.RecordTypePod,
+		Node:       node,
+		BeginTime:  beginTime,
+		EndTime:    now.Add(-10 * time.Minute),
+		Resources:  usage.Resources{Requests: usage.Ask{CPU: 1500, Memory: 4 << 30}, Allocated: usage.Ask{CPU: 1500, Memory: 4 << 30}},
+	}
+	deleted.Cost = usage.GetPodCost(deleted.Resources.Allocated, node.Cost, deleted.BeginTime, deleted.EndTime)
+	s.deletedPods = []*usage.PodInfo{deleted}
+
+	records := s.getRecords(context.Background(), []interface{}{pod}, now)
+
+	// node cost equals pods cost plus idle cost
+	var total float64
+	for _, record := range records {
+		total += record.Cost.Total
+	}
+	assert.InDelta(t, instanceHour*syncPeriod.Hours(), total, 1e-6)
+}
+
+func TestGetRecordsNormalizesAllocated(t *testing.T) {
+	const instanceHour = 0.096
+	allocatable := usage.Capacity{CPU: 2000, Memory: 8 << 30}
+	node := usage.NodeInfo{
+		Name:        "node1",
+		Capacity:    allocatable,
+		Allocatable: allocatable,
+		Cost:        usage.NewCost(instanceHour, "m5.large", allocatable, usage.DefaultWeights()),
+	}
+	now := time.Now()
+	beginTime := now.Add(-syncPeriod)
+	s := &scanner{
+		log:          logrus.NewEntry(logrus.New()),
+		nodeInformer: &NodesMap{data: map[string]usage.NodeInfo{node.Name: node}},
+		intervals:    newReportedIntervals(syncPeriod),
+	}
+	// pods allocated by usage above the node allocatable CPU
+	for _, name := range []string{"busy-a", "busy-b"} {
+		record := &usage.PodInfo{
+			Name:            name,
+			Namespace:       "default",
+			RecordType:      usage.RecordTypePod,
+			AllocationModel: usage.AllocationModelUsage,
+			Node:            node,
+			BeginTime:       beginTime,
+			EndTime:         now,
+			Resources:       usage.Resources{Requests: usage.Ask{CPU: 500, Memory: 1 << 30}, Allocated: usage.Ask{CPU: 1500, Memory: 1 << 30}},
+		}
+		record.Cost = usage.GetPodCost(record.Resources.Allocated, node.Cost, record.BeginTime, record.EndTime)
+		s.deletedPods = append(s.deletedPods, record)
+	}
+
+	records := s.getRecords(context.Background(), nil, now)
+
+	var allocated int64
+	var total float64
+	for _, record := range records {
+		if record.RecordType == usage.RecordTypePod {
+			allocated += record.Resources.Allocated.CPU
+		}
+		total += record.Cost.Total
+	}
+	// pods share the node allocatable CPU and costs add up to the node cost
+	assert.Equal(t, allocatable.CPU, allocated)
+	assert.InDelta(t, instanceHour*syncPeriod.Hours(), total, 1e-6)
+}
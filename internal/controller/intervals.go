@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type podInterval struct {
+	// end of the last reported pod interval
+	end time.Time
+	// deleted is true once the final pod record is reported
+	deleted bool
+}
+
+// reportedIntervals tracks the last reported interval end per pod UID, so each pod record starts exactly where
+// the previous one ended and the deleted pod record covers only the remaining time
+type reportedIntervals struct {
+	period time.Duration
+	mu     sync.Mutex
+	// upload is the end of the last upload interval, zero before the first upload
+	upload time.Time
+	pods   map[types.UID]*podInterval
+}
+
+func newReportedIntervals(period time.Duration) *reportedIntervals {
+	return &reportedIntervals{
+		period: period,
+		pods:   make(map[types.UID]*podInterval),
+	}
+}
+
+// begin returns the begin time of the interval ending now for records not tracked per pod:
+// the end of the last upload interval or one period ago before the first upload
+func (r *reportedIntervals) begin(now time.Time) time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.beginLocked(now)
+}
+
+// next returns the pod interval begin time and marks the pod reported till end, the time the pod stopped running
+// or now; the reported end never moves back, so a stopped pod is not reported again;
+// returns false if the pod final record is already reported
+func (r *reportedIntervals) next(uid types.UID, now, end time.Time) (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pod, ok := r.pods[uid]
+	if !ok {
+		begin := r.beginLocked(now)
+		if end.Before(begin) {
+			end = begin
+		}
+		r.pods[uid] = &podInterval{end: end}
+		return begin, true
+	}
+	if pod.deleted {
+		return time.Time{}, false
+	}
+	begin := pod.end
+	if end.After(pod.end) {
+		pod.end = end
+	}
+	return begin, true
+}
+
+// final returns the begin time of the deleted pod remaining interval and marks the pod final record reported
+func (r *reportedIntervals) final(uid types.UID, now time.Time) time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pod, ok := r.pods[uid]
+	if !ok {
+		r.pods[uid] = &podInterval{end: now, deleted: true}
+		return r.beginLocked(now)
+	}
+	begin := pod.end
+	pod.end = now
+	pod.deleted = true
+	return begin
+}
+
+// uploaded sets the end of the upload interval and forgets the pods that are no longer running
+func (r *reportedIntervals) uploaded(now time.Time, running map[types.UID]bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.upload = now
+	for uid := range r.pods {
+		if !running[uid] {
+			delete(r.pods, uid)
+		}
+	}
+}
+
+// beginLocked returns the end of the last upload interval or one period before now, before the first upload or
+// for pods deleted while the records were uploaded: timed before the upload and not listed in it
+func (r *reportedIntervals) beginLocked(now time.Time) time.Time {
+	if r.upload.IsZero() || now.Before(r.upload) {
+		return now.Add(-r.period)
+	}
+	return r.upload
+}
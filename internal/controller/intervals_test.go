@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestReportedIntervals(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := start.Add(syncPeriodDebug)
+	second := first.Add(syncPeriodDebug)
+	deleted := second.Add(2 * time.Minute)
+	third := second.Add(syncPeriodDebug)
+	intervals := newReportedIntervals(syncPeriodDebug)
+
+	// first upload: one period back
+	assert.Equal(t, start, intervals.begin(first))
+	begin, ok := intervals.next("pod1", first, first)
+	assert.True(t, ok)
+	assert.Equal(t, start, begin)
+	intervals.uploaded(first, map[types.UID]bool{"pod1": true})
+
+	// second upload: pod1 continues, new pod2 starts at the last upload
+	assert.Equal(t, first, intervals.begin(second))
+	begin, ok = intervals.next("pod1", second, second)
+	assert.True(t, ok)
+	assert.Equal(t, first, begin)
+	begin, ok = intervals.next("pod2", second, second)
+	assert.True(t, ok)
+	assert.Equal(t, first, begin)
+	intervals.uploaded(second, map[types.UID]bool{"pod1": true, "pod2": true})
+
+	// pod1 deleted: the final record covers the remaining slice only
+	assert.Equal(t, second, intervals.final("pod1", deleted))
+	// pod3 started and deleted between uploads
+	assert.Equal(t, second, intervals.final("pod3", deleted))
+
+	// third upload still lists deleted pod1: it is skipped
+	_, ok = intervals.next("pod1", third, third)
+	assert.False(t, ok)
+	begin, ok = intervals.next("pod2", third, third)
+	assert.True(t, ok)
+	assert.Equal(t, second, begin)
+	intervals.uploaded(third, map[types.UID]bool{"pod1": true, "pod2": true})
+
+	// pods no longer running are forgotten
+	intervals.uploaded(third, map[types.UID]bool{"pod2": true})
+	assert.Len(t, intervals.pods, 1)
+	assert.Contains(t, intervals.pods, types.UID("pod2"))
+}
+
+func TestReportedIntervalsStoppedPod(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := start.Add(syncPeriodDebug)
+	stopped := first.Add(time.Minute)
+	second := first.Add(syncPeriodDebug)
+	third := second.Add(syncPeriodDebug)
+	intervals := newReportedIntervals(syncPeriodDebug)
+
+	begin, ok := intervals.next("pod1", first, first)
+	assert.True(t, ok)
+	assert.Equal(t, start, begin)
+	intervals.uploaded(first, map[types.UID]bool{"pod1": true})
+
+	// pod1 stopped during the second interval: reported till it stopped
+	begin, ok = intervals.next("pod1", second, stopped)
+	assert.True(t, ok)
+	assert.Equal(t, first, begin)
+	intervals.uploaded(second, map[types.UID]bool{"pod1": true})
+
+	// stopped pod1 is still in the pod store: the interval does not advance
+	begin, ok = intervals.next("pod1", third, stopped)
+	assert.True(t, ok)
+	assert.Equal(t, stopped, begin)
+	intervals.uploaded(third, map[types.UID]bool{"pod1": true})
+
+	// pod2 stopped before it was first reported
+	begin, ok = intervals.next("pod2", third.Add(syncPeriodDebug), first)
+	assert.True(t, ok)
+	assert.Equal(t, third, begin)
+	assert.Equal(t, third, intervals.final("pod2", third.Add(syncPeriodDebug)))
+
+	// deleted pod1 final record begins when it stopped
+	assert.Equal(t, stopped, intervals.final("pod1", third.Add(time.Minute)))
+}
+
+func TestReportedIntervalsDeletedDuringUpload(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := start.Add(syncPeriodDebug)
+	deleted := first.Add(-time.Second)
+	intervals := newReportedIntervals(syncPeriodDebug)
+	intervals.uploaded(first, nil)
+
+	// pod deleted before the upload ended and not listed in it: one period back
+	assert.Equal(t, deleted.Add(-syncPeriodDebug), intervals.final("pod1", deleted))
+	assert.Equal(t, first, intervals.final("pod2", first.Add(time.Second)))
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	namespaceCacheSyncPeriod = 5 * time.Minute
+	// time to keep deleted namespace metadata for the deleted pods waiting for upload
+	deletedNamespaceRetention = 2 * syncPeriod
+)
+
+type NamespacesInformer interface {
+	Load(ctx context.Context, log *logrus.Entry, clientset kubernetes.Interface) error
+	SetMetadata(record *usage.PodInfo)
+}
+
+type namespaceMeta struct {
+	labels      map[string]string
+	annotations map[string]string
+	// deleted is the namespace deletion time, zero for existing namespaces
+	deleted time.Time
+}
+
+// NamespacesMap keeps the namespace labels and annotations selected by the metadata policy, including recently
+// deleted namespaces
+type NamespacesMap struct {
+	log        *logrus.Entry
+	metadata   *usage.MetadataPolicy
+	mu         sync.RWMutex
+	namespaces map[string]*namespaceMeta
+}
+
+func NewNamespacesInformer(metadata *usage.MetadataPolicy) NamespacesInformer {
+	return &NamespacesMap{
+		metadata:   metadata,
+		namespaces: make(map[string]*namespaceMeta),
+	}
+}
+
+// Load starts Namespace informer and waits for it to sync
+func (n *NamespacesMap) Load(ctx context.Context, log *logrus.Entry, clientset kubernetes.Interface) error {
+	n.log = log
+	factory := informers.NewSharedInformerFactory(clientset, namespaceCacheSyncPeriod)
+	informer := factory.Core().V1().Namespaces().Informer()
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    n.update,
+		UpdateFunc: func(_, obj interface{}) { n.update(obj) },
+		DeleteFunc: n.delete,
+	})
+	if err != nil {
+		return errors.Wrap(err, "adding namespace informer event handler")
+	}
+	factory.Start(ctx.Done())
+
+	log.Debug("waiting for namespace informer to sync")
+	syncCtx, cancel := context.WithTimeout(ctx, cacheSyncTimeout)
+	defer cancel()
+	for _, synced := range factory.WaitForCacheSync(syncCtx.Done()) {
+		if !synced {
+			return ErrCacheSync
+		}
+	}
+	go n.run(ctx)
+	return nil
+}
+
+// run forgets namespaces deleted long ago every sync period till the context is done
+func (n *NamespacesMap) run(ctx context.Context) {
+	ticker := time.NewTicker(syncPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.prune(time.Now())
+		}
+	}
+}
+
+// prune forgets namespaces deleted more than the retention before now
+func (n *NamespacesMap) prune(now time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for name, meta := range n.namespaces {
+		if !meta.deleted.IsZero() && now.Sub(meta.deleted) > deletedNamespaceRetention {
+			delete(n.namespaces, name)
+		}
+	}
+}
+
+// SetMetadata copies the record namespace labels and annotations into the record
+func (n *NamespacesMap) SetMetadata(record *usage.PodInfo) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if meta, ok := n.namespaces[record.Namespace]; ok {
+		record.NamespaceLabels = meta.labels
+		record.NamespaceAnnotations = meta.annotations
+	}
+}
+
+func (n *NamespacesMap) update(obj interface{}) {
+	namespace, ok := obj.(*v1.Namespace)
+	if !ok {
+		return
+	}
+	meta := &namespaceMeta{
+		labels:      n.metadata.Capture(&n.metadata.Namespaces.Labels, namespace.Labels),
+		annotations: n.metadata.Capture(&n.metadata.Namespaces.Annotations, namespace.Annotations),
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.namespaces[namespace.Name] = meta
+}
+
+// delete keeps the deleted namespace metadata for pods deleted along with it till pruned
+func (n *NamespacesMap) delete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	namespace, ok := obj.(*v1.Namespace)
+	if !ok {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if meta, ok := n.namespaces[namespace.Name]; ok {
+		meta.deleted = time.Now()
+	}
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNamespacesMapSetMetadata(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clientset := fake.NewSimpleClientset(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "team-a",
+		Labels:      map[string]string{"team": "a", "kubernetes.io/metadata.name": "team-a"},
+		Annotations: map[string]string{"cost-center": "cc-100", "owner": "alice"},
+	}})
+	metadata := usage.DefaultMetadataPolicy()
+	metadata.Namespaces.Labels.Include = []string{"team", "env"}
+	metadata.Namespaces.Annotations.Include = []string{"cost-*"}
+	metadata.Rename = map[string]string{"cost-center": "cost_center"}
+	assert.NoError(t, metadata.Compile())
+	namespacesInformer := NewNamespacesInformer(metadata)
+	err := namespacesInformer.Load(ctx, logrus.NewEntry(logrus.New()), clientset)
+	assert.NoError(t, err)
+
+	record := &usage.PodInfo{Namespace: "team-a"}
+	namespacesInformer.SetMetadata(record)
+	assert.Equal(t, map[string]string{"team": "a"}, record.NamespaceLabels)
+	assert.Equal(t, map[string]string{"cost_center": "cc-100"}, record.NamespaceAnnotations)
+
+	// deleted namespace metadata is kept for deleted pods
+	err = clientset.CoreV1().Namespaces().Delete(ctx, "team-a", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+	namespaces := namespacesInformer.(*NamespacesMap)
+	assert.Eventually(t, func() bool {
+		namespaces.mu.RLock()
+		defer namespaces.mu.RUnlock()
+		return !namespaces.namespaces["team-a"].deleted.IsZero()
+	}, time.Second, 10*time.Millisecond)
+	deleted := &usage.PodInfo{Namespace: "team-a"}
+	namespacesInformer.SetMetadata(deleted)
+	assert.Equal(t, map[string]string{"team": "a"}, deleted.NamespaceLabels)
+
+	// deleted namespace metadata is forgotten after the retention
+	namespaces.prune(time.Now())
+	assert.Contains(t, namespaces.namespaces, "team-a")
+	namespaces.prune(time.Now().Add(deletedNamespaceRetention + time.Minute))
+	assert.NotContains(t, namespaces.namespaces, "team-a")
+
+	// unknown namespace
+	other := &usage.PodInfo{Namespace: "team-b"}
+	namespacesInformer.SetMetadata(other)
+	assert.Nil(t, other.NamespaceLabels)
+}
@@ -2,9 +2,11 @@ package controller
 
 import (
 	"context"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/doitintl/eks-lens-agent/internal/aws/price"
 	"github.com/doitintl/eks-lens-agent/internal/usage"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -19,6 +21,8 @@ import (
 const (
 	delayDelete         = 1 * time.Minute
 	nodeCacheSyncPeriod = 5 * time.Minute
+	// reprice nodes periodically to pick up refreshed prices
+	nodePriceRefreshPeriod = 1 * time.Hour
 )
 
 var (
@@ -29,16 +33,30 @@ var (
 type NodesInformer interface {
 	Load(ctx context.Context, log *logrus.Entry, cluster string, clientset kubernetes.Interface) (chan bool, error)
 	GetNode(nodeName string) (*usage.NodeInfo, bool)
+	GetPodNode(ctx context.Context, pod *v1.Pod) (*usage.NodeInfo, bool, error)
+	GetNodes() []usage.NodeInfo
 }
 
 type NodesMap struct {
-	mu   sync.RWMutex
-	data map[string]usage.NodeInfo
+	mu          sync.RWMutex
+	data        map[string]usage.NodeInfo
+	pricer      price.NodePricer
+	weights     usage.Weights
+	commitments price.Commitments
+	// split instance cost over node capacity to attribute system-reserved overhead separately
+	overhead bool
+	// metadata policy selects the node labels and annotations
+	metadata *usage.MetadataPolicy
 }
 
-func NewNodesInformer() NodesInformer {
+func NewNodesInformer(pricer price.NodePricer, weights usage.Weights, commitments price.Commitments, overheadPolicy string, metadata *usage.MetadataPolicy) NodesInformer {
 	return &NodesMap{
-		data: make(map[string]usage.NodeInfo),
+		data:        make(map[string]usage.NodeInfo),
+		pricer:      pricer,
+		weights:     weights,
+		commitments: commitments,
+		overhead:    overheadPolicy != "" && overheadPolicy != usage.OverheadPolicyNone,
+		metadata:    metadata,
 	}
 }
 
@@ -49,6 +67,156 @@ func (n *NodesMap) GetNode(nodeName string) (*usage.NodeInfo, bool) {
 	return &nodeInfo, ok
 }
 
+// GetNodes returns all nodes in the map
+func (n *NodesMap) GetNodes() []usage.NodeInfo {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	nodes := make([]usage.NodeInfo, 0, len(n.data))
+	for _, nodeInfo := range n.data {
+		nodes = append(nodes, nodeInfo)
+	}
+	return nodes
+}
+
+// GetPodNode returns the node of the pod; Fargate node is patched with the pod provisioned capacity and priced
+func (n *NodesMap) GetPodNode(ctx context.Context, pod *v1.Pod) (*usage.NodeInfo, bool, error) {
+	nodeInfo, ok := n.GetNode(pod.Spec.NodeName)
+	if !ok || nodeInfo.ComputeType != usage.ComputeTypeFargate {
+		return nodeInfo, ok, nil
+	}
+	if err := usage.PatchFargateNodeInfo(pod, nodeInfo); err != nil {
+		return nodeInfo, ok, errors.Wrap(err, "patching fargate node info")
+	}
+	return nodeInfo, ok, n.priceNode(ctx, nodeInfo)
+}
+
+// newCost splits the instance hourly cost over node allocatable resources or, when attributing overhead, node capacity;
+// Fargate pods are billed for the provisioned capacity
+func (n *NodesMap) newCost(instanceHour float64, nodeInfo *usage.NodeInfo) usage.Cost {
+	return usage.NewCost(instanceHour, nodeInfo.InstanceType, n.costResources(nodeInfo), n.weights)
+}
+
+// costResources returns the node resources the instance cost is split over
+func (n *NodesMap) costResources(nodeInfo *usage.NodeInfo) usage.Capacity {
+	if n.overhead && nodeInfo.ComputeType != usage.ComputeTypeFargate {
+		return nodeInfo.Capacity
+	}
+	return nodeInfo.Allocatable
+}
+
+// priceNode sets the node hourly cost split by resource
+func (n *NodesMap) priceNode(ctx context.Context, nodeInfo *usage.NodeInfo) error {
+	if n.pricer == nil {
+		return nil
+	}
+	var instanceHour, listHour float64
+	var rule string
+	var err error
+	if pricer, ok := n.pricer.(price.RulePricer); ok {
+		instanceHour, listHour, rule, err = pricer.GetNodePriceRule(ctx, nodeInfo)
+	} else {
+		instanceHour, err = n.pricer.GetNodePrice(ctx, nodeInfo)
+		listHour = instanceHour
+	}
+	if err != nil {
+		return errors.Wrapf(err, "getting price for node %s", nodeInfo.Name)
+	}
+	nodeInfo.Cost = n.newCost(instanceHour, nodeInfo)
+	nodeInfo.Cost.ListHour = listHour
+	nodeInfo.Cost.OverrideHour = instanceHour
+	nodeInfo.Cost.PriceRule = rule
+	return nil
+}
+
+// applyCommitments prices ON_DEMAND nodes at the amortized effective price of commitments covering them
+func (n *NodesMap) applyCommitments(data map[string]usage.NodeInfo) {
+	if len(n.commitments) == 0 {
+		return
+	}
+	nodes := make([]*usage.NodeInfo, 0, len(data))
+	for name := range data {
+		nodeInfo := data[name]
+		nodes = append(nodes, &nodeInfo)
+	}
+	coverage := n.commitments.Apply(nodes)
+	for _, nodeInfo := range nodes {
+		if nodeInfo.Cost.OverrideHour == 0 {
+			continue
+		}
+		// reset the cost to the price after overrides, then apply coverage
+		instanceHour, commitment := nodeInfo.Cost.OverrideHour, ""
+		if cov, ok := coverage[nodeInfo.Name]; ok {
+			instanceHour, commitment = cov.EffectiveHour, strings.Join(cov.Commitments, ",")
+		}
+		cost := n.newCost(instanceHour, nodeInfo)
+		cost.ListHour, cost.OverrideHour = nodeInfo.Cost.ListHour, nodeInfo.Cost.OverrideHour
+		cost.PriceRule, cost.Commitment = nodeInfo.Cost.PriceRule, commitment
+		nodeInfo.Cost = cost
+		data[nodeInfo.Name] = *nodeInfo
+	}
+}
+
+// nodeInfo converts the node to NodeInfo and resolves its price; pricing failures are logged and the node is kept.
+// Fargate nodes are priced per pod, see GetPodNode
+func (n *NodesMap) nodeInfo(ctx context.Context, log *logrus.Entry, cluster string, node *v1.Node) (usage.NodeInfo, error) {
+	nodeInfo := usage.NodeInfoFromNode(cluster, node, n.metadata)
+	if nodeInfo.ComputeType == usage.ComputeTypeFargate {
+		return nodeInfo, nil
+	}
+	err := n.priceNode(ctx, &nodeInfo)
+	if err != nil {
+		log.WithError(err).WithFields(logrus.Fields{
+			"node":          node.Name,
+			"region":        nodeInfo.Region,
+			"instance-type": nodeInfo.InstanceType,
+			"capacity-type": nodeInfo.CapacityType,
+		}).Error("failed to price node")
+		return nodeInfo, err
+	}
+	if fixed := usage.FixedHour(n.costResources(&nodeInfo), n.weights); fixed > nodeInfo.Cost.OverrideHour {
+		log.WithFields(logrus.Fields{
+			"node":          node.Name,
+			"instance-type": nodeInfo.InstanceType,
+			"fixed-hour":    fixed,
+			"instance-hour": nodeInfo.Cost.OverrideHour,
+		}).Warn("extended resource prices exceed the instance price, scaling them down to it")
+	}
+	return nodeInfo, nil
+}
+
+// addNode adds the new node unpriced (zero cost) and prices it in background: pricing may load remote price lists
+// and must not block node events
+func (n *NodesMap) addNode(ctx context.Context, log *logrus.Entry, cluster string, node *v1.Node) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.data[node.Name]; ok {
+		// already added by the nodes map refresh
+		return
+	}
+	log.WithField("node", node.Name).Debug("adding unpriced node to map")
+	n.data[node.Name] = usage.NodeInfoFromNode(cluster, node, n.metadata)
+	if n.pricer != nil {
+		go n.priceAddedNode(ctx, log, cluster, node)
+	}
+}
+
+// priceAddedNode prices the added node and updates it in the map unless the nodes map refresh priced it meanwhile;
+// failed nodes are priced again and commitments are applied on the next refresh
+func (n *NodesMap) priceAddedNode(ctx context.Context, log *logrus.Entry, cluster string, node *v1.Node) {
+	nodeInfo, err := n.nodeInfo(ctx, log, cluster, node)
+	if err != nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	current, ok := n.data[node.Name]
+	if !ok || current.Cost.InstanceHour > 0 {
+		return
+	}
+	log.WithField("node", node.Name).Debug("priced added node")
+	n.data[node.Name] = nodeInfo
+}
+
 // Load loads the NodesMap with the current nodes in the cluster return channel to signal when the map is loaded
 //
 //nolint:funlen
@@ -82,12 +250,7 @@ func (n *NodesMap) Load(ctx context.Context, log *logrus.Entry, cluster string,
 	// Process Node add and delete events
 	_, err := nodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
-			node := obj.(*v1.Node)
-			nodeInfo := usage.NodeInfoFromNode(cluster, node)
-			n.mu.Lock()
-			defer n.mu.Unlock()
-			log.WithField("node", node.Name).Debug("adding node to map")
-			n.data[node.Name] = nodeInfo
+			n.addNode(ctx, log, cluster, obj.(*v1.Node))
 		},
 		DeleteFunc: func(obj interface{}) {
 			node, ok := obj.(*v1.Node)
@@ -118,26 +281,40 @@ func (n *NodesMap) Load(ctx context.Context, log *logrus.Entry, cluster string,
 	previousResourceVersion := "0" // the resource version of the nodes at the last sync
 	go func() {
 		// refresh the nodes map and send to the loaded channel (if not already sent)
+		unpriced := false         // some nodes failed to be priced at the last sync
+		var lastRefresh time.Time // the time of the last sync
 		refresh := func() {
-			n.mu.Lock()
-			defer n.mu.Unlock()
 			// Get the latest resource version of the nodes
 			lastSyncResourceVersion := nodeInformer.LastSyncResourceVersion()
-			// if not different from the current resource version of the nodes, skip
-			if lastSyncResourceVersion == previousResourceVersion {
+			// if not different from the current resource version of the nodes, all nodes are priced and prices are recent, skip
+			if lastSyncResourceVersion == previousResourceVersion && !unpriced && time.Since(lastRefresh) < nodePriceRefreshPeriod {
 				return
 			}
+			lastRefresh = time.Now()
 
-			// clear the nodes map
+			// build the nodes map outside the lock: pricing may load remote price lists
 			log.Debug("refreshing nodes map with latest nodes")
-			n.data = make(map[string]usage.NodeInfo)
-
-			// update the nodes map
+			data := make(map[string]usage.NodeInfo)
+			failed := 0
 			for _, obj := range nodeInformer.GetStore().List() {
 				node := obj.(*v1.Node)
 				log.WithField("node", node.Name).Debug("adding node to map")
-				n.data[node.Name] = usage.NodeInfoFromNode(cluster, node)
+				nodeInfo, err := n.nodeInfo(ctx, log, cluster, node)
+				if err != nil {
+					failed++
+				}
+				data[node.Name] = nodeInfo
 			}
+			if failed > 0 {
+				log.WithField("count", failed).Warn("failed to price nodes, retrying on next refresh")
+			}
+			unpriced = failed > 0
+			n.applyCommitments(data)
+
+			// replace the nodes map
+			n.mu.Lock()
+			n.data = data
+			n.mu.Unlock()
 
 			// Update the previous resource version
 			previousResourceVersion = lastSyncResourceVersion
@@ -2,9 +2,11 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/doitintl/eks-lens-agent/internal/aws/price"
 	"github.com/doitintl/eks-lens-agent/internal/usage"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -91,8 +93,9 @@ func TestNodesInformerLoad(t *testing.T) {
 			}
 
 			// Get the nodes from the NodesMap
-			actualNodes := make([]string, 0, len(nodesInformer.data))
-			for _, node := range nodesInformer.data {
+			nodes := nodesInformer.GetNodes()
+			actualNodes := make([]string, 0, len(nodes))
+			for _, node := range nodes {
 				actualNodes = append(actualNodes, node.Name)
 			}
 
@@ -101,3 +104,190 @@ func TestNodesInformerLoad(t *testing.T) {
 		})
 	}
 }
+
+// fakePricer implements price.NodePricer interface
+type fakePricer struct {
+	prices map[string]float64
+}
+
+func (f *fakePricer) GetNodePrice(_ context.Context, node *usage.NodeInfo) (float64, error) {
+	price, ok := f.prices[node.InstanceType]
+	if !ok {
+		return 0, errors.New("instance type not found")
+	}
+	return price, nil
+}
+
+func TestNodesInformerPricing(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	nodes := map[string]string{
+		"node1": "m5.large",
+		"node2": "unknown.large",
+	}
+	for name, instanceType := range nodes {
+		clientset.CoreV1().Nodes().Create(context.Background(), &v1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"node.kubernetes.io/instance-type": instanceType,
+				"topology.kubernetes.io/region":    "us-east-1",
+			},
+		}}, metav1.CreateOptions{})
+	}
+
+	nodesInformer := &NodesMap{
+		data:   make(map[string]usage.NodeInfo),
+		pricer: &fakePricer{prices: map[string]float64{"m5.large": 0.096}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Second)
+	defer cancel()
+	loaded, err := nodesInformer.Load(ctx, logrus.NewEntry(logrus.New()), "test-cluster", clientset)
+	assert.NoError(t, err)
+	select {
+	case <-loaded:
+	case <-ctx.Done():
+		t.Fatal("Loading nodes didn't finish in time")
+	}
+
+	// priced node carries the instance hourly price
+	node, ok := nodesInformer.GetNode("node1")
+	assert.True(t, ok)
+	assert.Equal(t, 0.096, node.Cost.InstanceHour)
+
+	// node that failed to be priced is still available
+	node, ok = nodesInformer.GetNode("node2")
+	assert.True(t, ok)
+	assert.Zero(t, node.Cost.InstanceHour)
+}
+
+func TestNodesMapGetPodNodeFargate(t *testing.T) {
+	nodesInformer := &NodesMap{
+		data: map[string]usage.NodeInfo{
+			"fargate-ip-192-168-1-1": {
+				Name:         "fargate-ip-192-168-1-1",
+				ComputeType:  usage.ComputeTypeFargate,
+				InstanceType: "fargate-2vCPU-4GB",
+			},
+		},
+		pricer:  &fakePricer{prices: map[string]float64{"fargate-0.25vCPU-0.5GB": 0.0123}},
+		weights: usage.DefaultWeights(),
+	}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{"CapacityProvisioned": "0.25vCPU 0.5GB"},
+		},
+		Spec: v1.PodSpec{NodeName: "fargate-ip-192-168-1-1"},
+	}
+
+	node, ok, err := nodesInformer.GetPodNode(context.Background(), pod)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, "fargate-0.25vCPU-0.5GB", node.InstanceType)
+	assert.Equal(t, 0.0123, node.Cost.InstanceHour)
+	assert.Positive(t, node.Cost.VCPUHour)
+
+	// cached node is not patched
+	cached, _ := nodesInformer.GetNode("fargate-ip-192-168-1-1")
+	assert.Equal(t, "fargate-2vCPU-4GB", cached.InstanceType)
+}
+
+func TestNodesMapApplyCommitments(t *testing.T) {
+	nodesInformer := &NodesMap{
+		weights:     usage.DefaultWeights(),
+		commitments: price.Commitments{{Name: "ri", Family: "m5", Count: 1, Rate: 0.06}},
+	}
+	allocatable := usage.Capacity{CPU: 2000, Memory: 8 << 30}
+	data := map[string]usage.NodeInfo{
+		"node1": {
+			Name:         "node1",
+			InstanceType: "m5.large",
+			CapacityType: usage.CapacityTypeOnDemand,
+			Allocatable:  allocatable,
+			Cost:         usage.Cost{InstanceHour: 0.096, ListHour: 0.096, OverrideHour: 0.096, PriceRule: "list"},
+		},
+		"node2": {
+			Name:         "node2",
+			InstanceType: "m5.large",
+			CapacityType: usage.CapacityTypeOnDemand,
+			Allocatable:  allocatable,
+			Created:      time.Now(),
+			Cost:         usage.Cost{InstanceHour: 0.096, ListHour: 0.096, OverrideHour: 0.096, PriceRule: "list"},
+		},
+	}
+	nodesInformer.applyCommitments(data)
+
+	// the oldest node is covered by the reserved instance
+	assert.Equal(t, 0.06, data["node1"].Cost.InstanceHour)
+	assert.Equal(t, 0.096, data["node1"].Cost.ListHour)
+	assert.Equal(t, "ri", data["node1"].Cost.Commitment)
+	assert.Equal(t, "list", data["node1"].Cost.PriceRule)
+	assert.Positive(t, data["node1"].Cost.VCPUHour)
+
+	// uncovered node is priced at the list price
+	assert.Equal(t, 0.096, data["node2"].Cost.InstanceHour)
+	assert.Empty(t, data["node2"].Cost.Commitment)
+}
+
+func TestNodesMapPriceNodeOverrides(t *testing.T) {
+	overrides := &price.Overrides{Discount: 25}
+	nodesInformer := &NodesMap{
+		pricer:  price.WithOverrides(&fakePricer{prices: map[string]float64{"m5.large": 0.096}}, overrides),
+		weights: usage.DefaultWeights(),
+	}
+	nodeInfo := &usage.NodeInfo{
+		Name:         "node1",
+		InstanceType: "m5.large",
+		CapacityType: usage.CapacityTypeOnDemand,
+		Allocatable:  usage.Capacity{CPU: 2000, Memory: 8 << 30},
+	}
+	assert.NoError(t, nodesInformer.priceNode(context.Background(), nodeInfo))
+
+	// list price is kept apart from the discounted price
+	assert.Equal(t, 0.096, nodeInfo.Cost.ListHour)
+	assert.InDelta(t, 0.072, nodeInfo.Cost.OverrideHour, 1e-9)
+	assert.InDelta(t, 0.072, nodeInfo.Cost.InstanceHour, 1e-9)
+	assert.Equal(t, "discount:25%", nodeInfo.Cost.PriceRule)
+}
+
+// blockingPricer implements price.NodePricer interface, blocking till released
+type blockingPricer struct {
+	release chan struct{}
+	price   float64
+}
+
+func (b *blockingPricer) GetNodePrice(ctx context.Context, _ *usage.NodeInfo) (float64, error) {
+	select {
+	case <-b.release:
+		return b.price, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func TestNodesMapAddNode(t *testing.T) {
+	pricer := &blockingPricer{release: make(chan struct{}), price: 0.096}
+	nodesInformer := &NodesMap{
+		data:    make(map[string]usage.NodeInfo),
+		pricer:  pricer,
+		weights: usage.DefaultWeights(),
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node1",
+		Labels: map[string]string{"node.kubernetes.io/instance-type": "m5.large"},
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the node is added unpriced without waiting for the price lookup
+	nodesInformer.addNode(ctx, logrus.NewEntry(logrus.New()), "test-cluster", node)
+	added, ok := nodesInformer.GetNode("node1")
+	assert.True(t, ok)
+	assert.Zero(t, added.Cost.InstanceHour)
+
+	// the node is priced once the lookup finishes
+	close(pricer.release)
+	assert.Eventually(t, func() bool {
+		priced, _ := nodesInformer.GetNode("node1")
+		return priced.Cost.InstanceHour == 0.096
+	}, 5*time.Second, 10*time.Millisecond)
+}
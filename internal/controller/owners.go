@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	ownerCacheSyncPeriod = 5 * time.Minute
+	kindReplicaSet       = "ReplicaSet"
+	kindJob              = "Job"
+)
+
+type OwnersInformer interface {
+	Load(ctx context.Context, log *logrus.Entry, clientset kubernetes.Interface) error
+	SetOwners(record *usage.PodInfo, pod *v1.Pod)
+}
+
+// OwnersMap resolves pod workload owners from ReplicaSet and Job informers: ReplicaSets are owned by
+// Deployments or custom controllers (e.g. Argo Rollouts), Jobs are owned by CronJobs
+type OwnersMap struct {
+	replicaSets appslisters.ReplicaSetLister
+	jobs        batchlisters.JobLister
+}
+
+func NewOwnersInformer() OwnersInformer {
+	return &OwnersMap{}
+}
+
+// Load starts ReplicaSet and Job informers and waits for them to sync
+func (o *OwnersMap) Load(ctx context.Context, log *logrus.Entry, clientset kubernetes.Interface) error {
+	factory := informers.NewSharedInformerFactory(clientset, ownerCacheSyncPeriod)
+	replicaSets := factory.Apps().V1().ReplicaSets()
+	jobs := factory.Batch().V1().Jobs()
+	// keep object metadata only, owner references are all we need
+	for _, informer := range []cache.SharedIndexInformer{replicaSets.Informer(), jobs.Informer()} {
+		if err := informer.SetTransform(stripOwnerObject); err != nil {
+			return errors.Wrap(err, "setting owner informer transform")
+		}
+	}
+	o.replicaSets = replicaSets.Lister()
+	o.jobs = jobs.Lister()
+	factory.Start(ctx.Done())
+
+	log.Debug("waiting for owner informers to sync")
+	syncCtx, cancel := context.WithTimeout(ctx, cacheSyncTimeout)
+	defer cancel()
+	for _, synced := range factory.WaitForCacheSync(syncCtx.Done()) {
+		if !synced {
+			return ErrCacheSync
+		}
+	}
+	return nil
+}
+
+// SetOwners sets the record pod controller owner and the top owner up the ownership chain
+func (o *OwnersMap) SetOwners(record *usage.PodInfo, pod *v1.Pod) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return
+	}
+	record.OwnerKind = owner.Kind
+	record.OwnerName = owner.Name
+	record.TopOwnerKind = owner.Kind
+	record.TopOwnerName = owner.Name
+	// ReplicaSet and Job owners, if any, are the top owners
+	var top *metav1.OwnerReference
+	switch owner.Kind {
+	case kindReplicaSet:
+		if rs, err := o.replicaSets.ReplicaSets(pod.Namespace).Get(owner.Name); err == nil {
+			top = metav1.GetControllerOf(rs)
+		}
+	case kindJob:
+		if job, err := o.jobs.Jobs(pod.Namespace).Get(owner.Name); err == nil {
+			top = metav1.GetControllerOf(job)
+		}
+	}
+	if top != nil {
+		record.TopOwnerKind = top.Kind
+		record.TopOwnerName = top.Name
+	}
+}
+
+// stripOwnerObject drops ReplicaSet and Job spec and status to reduce the informer cache memory
+func stripOwnerObject(obj interface{}) (interface{}, error) {
+	switch o := obj.(type) {
+	case *appsv1.ReplicaSet:
+		return &appsv1.ReplicaSet{ObjectMeta: ownerMeta(&o.ObjectMeta)}, nil
+	case *batchv1.Job:
+		return &batchv1.Job{ObjectMeta: ownerMeta(&o.ObjectMeta)}, nil
+	default:
+		return obj, nil
+	}
+}
+
+func ownerMeta(meta *metav1.ObjectMeta) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:            meta.Name,
+		Namespace:       meta.Namespace,
+		UID:             meta.UID,
+		ResourceVersion: meta.ResourceVersion,
+		OwnerReferences: meta.OwnerReferences,
+	}
+}
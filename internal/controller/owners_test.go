@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func controllerRef(kind, name string) []metav1.OwnerReference {
+	isController := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &isController}}
+}
+
+func TestOwnersMapSetOwners(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clientset := fake.NewSimpleClientset(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "web-5d9f", OwnerReferences: controllerRef("Deployment", "web")}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "canary-7c4b", OwnerReferences: controllerRef("Rollout", "canary")}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "report-28100", OwnerReferences: controllerRef("CronJob", "report")}},
+	)
+	ownersInformer := NewOwnersInformer()
+	err := ownersInformer.Load(ctx, logrus.NewEntry(logrus.New()), clientset)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		owners    []metav1.OwnerReference
+		wantOwner [2]string
+		wantTop   [2]string
+	}{
+		{name: "deployment", owners: controllerRef("ReplicaSet", "web-5d9f"), wantOwner: [2]string{"ReplicaSet", "web-5d9f"}, wantTop: [2]string{"Deployment", "web"}},
+		{name: "argo rollout", owners: controllerRef("ReplicaSet", "canary-7c4b"), wantOwner: [2]string{"ReplicaSet", "canary-7c4b"}, wantTop: [2]string{"Rollout", "canary"}},
+		{name: "cronjob", owners: controllerRef("Job", "report-28100"), wantOwner: [2]string{"Job", "report-28100"}, wantTop: [2]string{"CronJob", "report"}},
+		{name: "statefulset", owners: controllerRef("StatefulSet", "db"), wantOwner: [2]string{"StatefulSet", "db"}, wantTop: [2]string{"StatefulSet", "db"}},
+		{name: "deleted replicaset", owners: controllerRef("ReplicaSet", "old-1a2b"), wantOwner: [2]string{"ReplicaSet", "old-1a2b"}, wantTop: [2]string{"ReplicaSet", "old-1a2b"}},
+		{name: "bare pod"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "pod", OwnerReferences: tt.owners}}
+			record := &usage.PodInfo{}
+			ownersInformer.SetOwners(record, pod)
+			assert.Equal(t, tt.wantOwner, [2]string{record.OwnerKind, record.OwnerName})
+			assert.Equal(t, tt.wantTop, [2]string{record.TopOwnerKind, record.TopOwnerName})
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/doitintl/eks-lens-agent/internal/aws/price"
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	serviceCacheSyncPeriod = 5 * time.Minute
+	// load balancer type annotation: nlb, nlb-ip or external (AWS Load Balancer Controller NLB)
+	loadBalancerTypeAnnotation = "service.beta.kubernetes.io/aws-load-balancer-type"
+	// load balancer class of AWS Load Balancer Controller NLB
+	nlbLoadBalancerClass = "service.k8s.aws/nlb"
+	loadBalancerCLB      = "clb"
+	loadBalancerNLB      = "nlb"
+)
+
+type ServicesInformer interface {
+	RecordsSource
+	Load(ctx context.Context, log *logrus.Entry, clientset kubernetes.Interface) error
+}
+
+type ServicesMap struct {
+	log      *logrus.Entry
+	cluster  string
+	prices   price.LoadBalancerPrices
+	services corelisters.ServiceLister
+	// mu guards the services deleted since the last records
+	mu              sync.Mutex
+	deletedServices []deletedService
+}
+
+// deletedService is the service deleted since the last records
+type deletedService struct {
+	service *v1.Service
+	deleted time.Time
+}
+
+func NewServicesInformer(cluster string, prices price.LoadBalancerPrices) ServicesInformer {
+	return &ServicesMap{
+		cluster: cluster,
+		prices:  prices,
+	}
+}
+
+// Load starts Service informer and waits for it to sync
+func (s *ServicesMap) Load(ctx context.Context, log *logrus.Entry, clientset kubernetes.Interface) error {
+	s.log = log
+	factory := informers.NewSharedInformerFactory(clientset, serviceCacheSyncPeriod)
+	services := factory.Core().V1().Services()
+	s.services = services.Lister()
+	// deleted services are reported till they were deleted
+	if _, err := services.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{DeleteFunc: s.deleteService}); err != nil {
+		return errors.Wrap(err, "adding service informer event handler")
+	}
+	factory.Start(ctx.Done())
+
+	log.Debug("waiting for service informer to sync")
+	syncCtx, cancel := context.WithTimeout(ctx, cacheSyncTimeout)
+	defer cancel()
+	for _, synced := range factory.WaitForCacheSync(syncCtx.Done()) {
+		if !synced {
+			return ErrCacheSync
+		}
+	}
+	return nil
+}
+
+func (s *ServicesMap) deleteService(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	service, ok := obj.(*v1.Service)
+	if !ok || service.Spec.Type != v1.ServiceTypeLoadBalancer {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deletedServices = append(s.deletedServices, deletedService{service: service, deleted: time.Now()})
+}
+
+// takeDeleted returns the services deleted since the last records and clears them
+func (s *ServicesMap) takeDeleted() []deletedService {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	services := s.deletedServices
+	s.deletedServices = nil
+	return services
+}
+
+// GetRecords returns the LoadBalancer Service records; services deleted during the interval are reported till
+// they were deleted
+func (s *ServicesMap) GetRecords(_ []*v1.Pod, beginTime, endTime time.Time) []*usage.PodInfo {
+	services, err := s.services.List(labels.Everything())
+	if err != nil {
+		s.log.WithError(err).Error("listing services")
+		return nil
+	}
+	deletedServices := s.takeDeleted()
+	records := make([]*usage.PodInfo, 0, len(deletedServices))
+	for _, service := range services {
+		if service.Spec.Type == v1.ServiceTypeLoadBalancer {
+			records = append(records, s.serviceRecord(service, beginTime, endTime))
+		}
+	}
+	for _, deleted := range deletedServices {
+		// service deleted before the interval was reported by the previous records
+		if !deleted.deleted.After(beginTime) {
+			continue
+		}
+		// final record of the service deleted during the interval
+		deletedTime := deleted.deleted
+		if deletedTime.After(endTime) {
+			deletedTime = endTime
+		}
+		records = append(records, s.serviceRecord(deleted.service, beginTime, deletedTime))
+	}
+	return records
+}
+
+// serviceRecord returns the load balancer record of the service for the beginTime-endTime interval
+func (s *ServicesMap) serviceRecord(service *v1.Service, beginTime, endTime time.Time) *usage.PodInfo {
+	lb := &usage.LoadBalancerInfo{Type: loadBalancerType(service)}
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.Hostname != "" {
+			lb.Hostname = ingress.Hostname
+			break
+		}
+	}
+	// load balancer is billed once provisioned
+	if lb.Hostname != "" {
+		lb.HourlyCost = s.prices[lb.Type]
+	}
+	return usage.GetLoadBalancerInfo(s.cluster, service.Name, service.Namespace, service.CreationTimestamp.Time, lb, beginTime, endTime)
+}
+
+// loadBalancerType returns the load balancer type of the service: NLB or Classic Load Balancer (default)
+func loadBalancerType(service *v1.Service) string {
+	if service.Spec.LoadBalancerClass != nil && *service.Spec.LoadBalancerClass == nlbLoadBalancerClass {
+		return loadBalancerNLB
+	}
+	switch service.Annotations[loadBalancerTypeAnnotation] {
+	case "nlb", "nlb-ip", "external":
+		return loadBalancerNLB
+	default:
+		return loadBalancerCLB
+	}
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/doitintl/eks-lens-agent/internal/aws/price"
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestServicesMapGetRecords(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	provisioned := v1.ServiceStatus{LoadBalancer: v1.LoadBalancerStatus{
+		Ingress: []v1.LoadBalancerIngress{{Hostname: "a1b2.elb.us-east-1.amazonaws.com"}},
+	}}
+	clientset := fake.NewSimpleClientset(
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "web"},
+			Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+			Status:     provisioned,
+		},
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "team-b",
+				Name:        "api",
+				Annotations: map[string]string{loadBalancerTypeAnnotation: "external"},
+			},
+			Spec:   v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+			Status: provisioned,
+		},
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "pending"},
+			Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+		},
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "internal"},
+			Spec:       v1.ServiceSpec{Type: v1.ServiceTypeClusterIP},
+		},
+	)
+
+	servicesInformer := NewServicesInformer("test-cluster", price.DefaultLoadBalancerPrices())
+	err := servicesInformer.Load(ctx, logrus.NewEntry(logrus.New()), clientset)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	records := servicesInformer.GetRecords(nil, now.Add(-time.Hour), now)
+	assert.Len(t, records, 3)
+	byName := make(map[string]*usage.PodInfo)
+	for _, record := range records {
+		assert.Equal(t, usage.RecordTypeLoadBalancer, record.RecordType)
+		byName[record.Namespace+"/"+record.Name] = record
+	}
+
+	// Classic Load Balancer by default
+	web := byName["team-a/web"]
+	assert.Equal(t, loadBalancerCLB, web.LoadBalancer.Type)
+	assert.Equal(t, "a1b2.elb.us-east-1.amazonaws.com", web.LoadBalancer.Hostname)
+	assert.InDelta(t, 0.025, web.Cost.Total, 1e-9)
+
+	// NLB from annotation
+	api := byName["team-b/api"]
+	assert.Equal(t, loadBalancerNLB, api.LoadBalancer.Type)
+	assert.InDelta(t, 0.0225, api.Cost.LoadBalancer, 1e-9)
+
+	// load balancer not provisioned yet
+	assert.Zero(t, byName["team-b/pending"].Cost.Total)
+}
+
+func TestServicesMapGetRecordsDeleted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	provisioned := v1.ServiceStatus{LoadBalancer: v1.LoadBalancerStatus{
+		Ingress: []v1.LoadBalancerIngress{{Hostname: "a1b2.elb.us-east-1.amazonaws.com"}},
+	}}
+	beginTime := time.Now().Add(-time.Hour)
+	// service created during the interval and deleted before its end
+	deleted := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "team-a",
+			Name:              "web",
+			CreationTimestamp: metav1.NewTime(beginTime.Add(30 * time.Minute)),
+		},
+		Spec:   v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+		Status: provisioned,
+	}
+	clientset := fake.NewSimpleClientset()
+
+	servicesInformer := NewServicesInformer("test-cluster", price.DefaultLoadBalancerPrices())
+	err := servicesInformer.Load(ctx, logrus.NewEntry(logrus.New()), clientset)
+	assert.NoError(t, err)
+	services := servicesInformer.(*ServicesMap)
+
+	services.deleteService(deleted)
+	// ClusterIP service is not billed
+	services.deleteService(&v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "internal"},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeClusterIP},
+	})
+	endTime := time.Now().Add(time.Hour)
+
+	records := services.GetRecords(nil, beginTime, endTime)
+	assert.Len(t, records, 1)
+	// final record of the deleted service, charged from its creation till it was deleted
+	record := records[0]
+	assert.Equal(t, "web", record.Name)
+	assert.Equal(t, deleted.CreationTimestamp.Time, record.BeginTime)
+	assert.True(t, record.EndTime.Before(endTime))
+	assert.InDelta(t, 0.025*record.EndTime.Sub(record.BeginTime).Hours(), record.Cost.Total, 1e-9)
+
+	// deleted services are reported once
+	assert.Empty(t, services.GetRecords(nil, endTime, endTime.Add(time.Hour)))
+}
@@ -0,0 +1,258 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// UsageSourceMetrics collects pod usage from metrics.k8s.io API (metrics-server)
+	UsageSourceMetrics = "metrics"
+	// UsageSourceKubelet collects pod usage from kubelet /stats/summary endpoint through API server node proxy
+	UsageSourceKubelet = "kubelet"
+	podMetricsPath     = "/apis/metrics.k8s.io/v1beta1/pods"
+	statsSummaryPath   = "stats/summary"
+)
+
+// PodSample is the current resources usage of a pod; UID is empty when the source does not report it
+type PodSample struct {
+	Namespace string
+	Name      string
+	UID       types.UID
+	Usage     usage.UsageSample
+}
+
+// UsageSource returns the current resources usage of pods
+type UsageSource interface {
+	GetPodsUsage(ctx context.Context) ([]PodSample, error)
+}
+
+type metricsUsageSource struct {
+	client rest.Interface
+}
+
+// NewMetricsUsageSource returns pod usage source backed by metrics.k8s.io API
+func NewMetricsUsageSource(client rest.Interface) UsageSource {
+	return &metricsUsageSource{client: client}
+}
+
+// podMetricsList is the subset of metrics.k8s.io PodMetricsList used
+type podMetricsList struct {
+	Items []struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Containers []struct {
+			Usage map[string]resource.Quantity `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// GetPodsUsage returns the pods usage; pod metrics carry no pod UID
+func (m *metricsUsageSource) GetPodsUsage(ctx context.Context) ([]PodSample, error) {
+	data, err := m.client.Get().AbsPath(podMetricsPath).DoRaw(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting pod metrics")
+	}
+	return parsePodMetrics(data)
+}
+
+func parsePodMetrics(data []byte) ([]PodSample, error) {
+	var list podMetricsList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, errors.Wrap(err, "parsing pod metrics")
+	}
+	result := make([]PodSample, 0, len(list.Items))
+	for _, item := range list.Items {
+		sample := PodSample{Namespace: item.Metadata.Namespace, Name: item.Metadata.Name}
+		for _, container := range item.Containers {
+			cpu := container.Usage["cpu"]
+			memory := container.Usage["memory"]
+			sample.Usage.CPU += cpu.MilliValue()
+			sample.Usage.Memory += memory.Value()
+		}
+		result = append(result, sample)
+	}
+	return result, nil
+}
+
+type kubeletUsageSource struct {
+	client rest.Interface
+	nodes  NodesInformer
+}
+
+// NewKubeletUsageSource returns pod usage source backed by kubelet stats summary of the cluster nodes
+func NewKubeletUsageSource(client rest.Interface, nodes NodesInformer) UsageSource {
+	return &kubeletUsageSource{client: client, nodes: nodes}
+}
+
+// statsSummary is the subset of kubelet stats summary used
+type statsSummary struct {
+	Pods []struct {
+		PodRef struct {
+			Name      string    `json:"name"`
+			Namespace string    `json:"namespace"`
+			UID       types.UID `json:"uid"`
+		} `json:"podRef"`
+		CPU *struct {
+			UsageNanoCores *uint64 `json:"usageNanoCores"`
+		} `json:"cpu"`
+		Memory *struct {
+			WorkingSetBytes *uint64 `json:"workingSetBytes"`
+		} `json:"memory"`
+		EphemeralStorage *struct {
+			UsedBytes *uint64 `json:"usedBytes"`
+		} `json:"ephemeral-storage"`
+	} `json:"pods"`
+}
+
+func (k *kubeletUsageSource) GetPodsUsage(ctx context.Context) ([]PodSample, error) {
+	var result []PodSample
+	var lastErr error
+	for _, node := range k.nodes.GetNodes() {
+		data, err := k.client.Get().Resource("nodes").Name(node.Name).SubResource("proxy").Suffix(statsSummaryPath).DoRaw(ctx)
+		if err != nil {
+			// skip unreachable node and keep collecting the others
+			lastErr = errors.Wrapf(err, "getting node %s stats summary", node.Name)
+			continue
+		}
+		samples, err := parseStatsSummary(data)
+		if err != nil {
+			lastErr = errors.Wrapf(err, "node %s", node.Name)
+			continue
+		}
+		result = append(result, samples...)
+	}
+	return result, lastErr
+}
+
+func parseStatsSummary(data []byte) ([]PodSample, error) {
+	var summary statsSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, errors.Wrap(err, "parsing stats summary")
+	}
+	result := make([]PodSample, 0, len(summary.Pods))
+	for _, pod := range summary.Pods {
+		sample := PodSample{Namespace: pod.PodRef.Namespace, Name: pod.PodRef.Name, UID: pod.PodRef.UID}
+		if pod.CPU != nil && pod.CPU.UsageNanoCores != nil {
+			sample.Usage.CPU = int64(*pod.CPU.UsageNanoCores / 1e6)
+		}
+		if pod.Memory != nil && pod.Memory.WorkingSetBytes != nil {
+			sample.Usage.Memory = int64(*pod.Memory.WorkingSetBytes)
+		}
+		if pod.EphemeralStorage != nil && pod.EphemeralStorage.UsedBytes != nil {
+			sample.Usage.StorageEphemeral = int64(*pod.EphemeralStorage.UsedBytes)
+		}
+		result = append(result, sample)
+	}
+	return result, nil
+}
+
+// UsageCollector samples pod usage periodically and aggregates it per pod UID and record interval, so pods
+// recreated under the same name (e.g. StatefulSet pods) do not mix samples
+type UsageCollector struct {
+	source UsageSource
+	period time.Duration
+	// running pods by "namespace/name" key resolving the UID of samples without one
+	running cache.Store
+	mu      sync.Mutex
+	pods    map[types.UID]*usage.UsageAccumulator
+}
+
+func NewUsageCollector(source UsageSource, period time.Duration) *UsageCollector {
+	return &UsageCollector{
+		source: source,
+		period: period,
+		pods:   make(map[types.UID]*usage.UsageAccumulator),
+	}
+}
+
+// Run samples usage of the running pods every period until the context is done
+func (c *UsageCollector) Run(ctx context.Context, log *logrus.Entry, running cache.Store) {
+	c.running = running
+	ticker := time.NewTicker(c.period)
+	defer ticker.Stop()
+	for {
+		if err := c.sample(ctx); err != nil {
+			log.WithError(err).Warn("sampling pod usage")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *UsageCollector) sample(ctx context.Context) error {
+	samples, err := c.source.GetPodsUsage(ctx)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// keep partial samples, e.g. some nodes not reachable
+	for _, sample := range samples {
+		uid := sample.UID
+		if uid == "" {
+			uid = c.runningUID(sample.Namespace, sample.Name)
+		}
+		if uid == "" {
+			continue
+		}
+		acc, ok := c.pods[uid]
+		if !ok {
+			acc = &usage.UsageAccumulator{}
+			c.pods[uid] = acc
+		}
+		acc.Add(sample.Usage)
+	}
+	return err
+}
+
+// runningUID returns the UID of the running pod, empty if the pod is not running
+func (c *UsageCollector) runningUID(namespace, name string) types.UID {
+	if c.running == nil {
+		return ""
+	}
+	obj, ok, err := c.running.GetByKey(namespace + "/" + name)
+	if err != nil || !ok {
+		return ""
+	}
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return ""
+	}
+	return pod.UID
+}
+
+// Take returns the pod usage since the last Collect and stops aggregating it
+func (c *UsageCollector) Take(uid types.UID) *usage.ResourceUsage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	acc := c.pods[uid]
+	delete(c.pods, uid)
+	return acc.Usage()
+}
+
+// Collect returns the pods usage by pod UID and starts the next interval
+func (c *UsageCollector) Collect() map[types.UID]*usage.ResourceUsage {
+	c.mu.Lock()
+	pods := c.pods
+	c.pods = make(map[types.UID]*usage.UsageAccumulator)
+	c.mu.Unlock()
+	result := make(map[types.UID]*usage.ResourceUsage, len(pods))
+	for uid, acc := range pods {
+		result[uid] = acc.Usage()
+	}
+	return result
+}
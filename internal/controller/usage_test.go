@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+type fakeUsageSource struct {
+	samples [][]PodSample
+}
+
+func (f *fakeUsageSource) GetPodsUsage(_ context.Context) ([]PodSample, error) {
+	sample := f.samples[0]
+	f.samples = f.samples[1:]
+	return sample, nil
+}
+
+func TestParsePodMetrics(t *testing.T) {
+	data := []byte(`{"kind":"PodMetricsList","items":[{"metadata":{"name":"web","namespace":"team-a"},
+		"containers":[{"name":"app","usage":{"cpu":"250m","memory":"100Mi"}},{"name":"proxy","usage":{"cpu":"1500000n","memory":"1Mi"}}]}]}`)
+	got, err := parsePodMetrics(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []PodSample{
+		{Namespace: "team-a", Name: "web", Usage: usage.UsageSample{CPU: 252, Memory: 101 << 20}},
+	}, got)
+}
+
+func TestParseStatsSummary(t *testing.T) {
+	data := []byte(`{"node":{"nodeName":"node-1"},"pods":[
+		{"podRef":{"name":"web","namespace":"team-a","uid":"1"},"cpu":{"usageNanoCores":125000000},
+		 "memory":{"workingSetBytes":1048576},"ephemeral-storage":{"usedBytes":4096}},
+		{"podRef":{"name":"starting","namespace":"team-a","uid":"2"}}]}`)
+	got, err := parseStatsSummary(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []PodSample{
+		{Namespace: "team-a", Name: "web", UID: "1", Usage: usage.UsageSample{CPU: 125, Memory: 1 << 20, StorageEphemeral: 4096}},
+		{Namespace: "team-a", Name: "starting", UID: "2"},
+	}, got)
+}
+
+func TestUsageCollector(t *testing.T) {
+	ctx := context.Background()
+	source := &fakeUsageSource{samples: [][]PodSample{
+		{
+			{Namespace: "team-a", Name: "web", UID: "web-1", Usage: usage.UsageSample{CPU: 100, Memory: 300}},
+			{Namespace: "team-a", Name: "job", UID: "job-1", Usage: usage.UsageSample{CPU: 50, Memory: 10}},
+		},
+		{{Namespace: "team-a", Name: "web", UID: "web-1", Usage: usage.UsageSample{CPU: 300, Memory: 100}}},
+		{{Namespace: "team-a", Name: "web", UID: "web-1", Usage: usage.UsageSample{CPU: 200, Memory: 200}}},
+	}}
+	collector := NewUsageCollector(source, 0)
+	assert.NoError(t, collector.sample(ctx))
+	assert.NoError(t, collector.sample(ctx))
+
+	// deleted pod usage is taken out of the interval
+	assert.Equal(t, &usage.ResourceUsage{CPUAvg: 50, CPUPeak: 50, MemoryAvg: 10, MemoryPeak: 10, Samples: 1}, collector.Take("job-1"))
+	assert.Nil(t, collector.Take("job-1"))
+
+	got := collector.Collect()
+	assert.Equal(t, map[types.UID]*usage.ResourceUsage{
+		"web-1": {CPUAvg: 200, CPUPeak: 300, MemoryAvg: 200, MemoryPeak: 300, Samples: 2},
+	}, got)
+
+	// next interval starts with the next sample
+	assert.NoError(t, collector.sample(ctx))
+	assert.Equal(t, int64(1), collector.Collect()["web-1"].Samples)
+}
+
+func TestUsageCollectorRecreatedPod(t *testing.T) {
+	ctx := context.Background()
+	running := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "db-0", UID: "db-0-1"}}
+	assert.NoError(t, running.Add(pod))
+	// pod metrics carry no pod UID
+	source := &fakeUsageSource{samples: [][]PodSample{
+		{{Namespace: "team-a", Name: "db-0", Usage: usage.UsageSample{CPU: 100}}},
+		{{Namespace: "team-a", Name: "db-0", Usage: usage.UsageSample{CPU: 500}}},
+		{{Namespace: "team-a", Name: "unknown", Usage: usage.UsageSample{CPU: 10}}},
+	}}
+	collector := NewUsageCollector(source, 0)
+	collector.running = running
+	assert.NoError(t, collector.sample(ctx))
+
+	// StatefulSet pod recreated under the same name
+	assert.NoError(t, running.Delete(pod))
+	assert.NoError(t, running.Add(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "db-0", UID: "db-0-2"}}))
+	assert.NoError(t, collector.sample(ctx))
+	// sample of a pod not running is dropped
+	assert.NoError(t, collector.sample(ctx))
+
+	assert.Equal(t, &usage.ResourceUsage{CPUAvg: 100, CPUPeak: 100, Samples: 1}, collector.Take("db-0-1"))
+	assert.Equal(t, map[types.UID]*usage.ResourceUsage{
+		"db-0-2": {CPUAvg: 500, CPUPeak: 500, Samples: 1},
+	}, collector.Collect())
+}
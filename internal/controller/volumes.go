@@ -0,0 +1,289 @@
+package controller
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doitintl/eks-lens-agent/internal/aws/price"
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	volumeCacheSyncPeriod = 5 * time.Minute
+	// time to wait for informers to sync, e.g. missing RBAC permissions
+	cacheSyncTimeout = 2 * time.Minute
+	// EBS and EFS CSI drivers and in-tree EBS provisioner
+	ebsCSIDriver         = "ebs.csi.aws.com"
+	efsCSIDriver         = "efs.csi.aws.com"
+	ebsInTreeProvisioner = "kubernetes.io/aws-ebs"
+	// provisioner annotation of dynamically provisioned volumes
+	provisionedByAnnotation = "pv.kubernetes.io/provisioned-by"
+	// gp3 baseline IOPS and throughput in MiB/s
+	gp3BaselineIOPS       = 3000
+	gp3BaselineThroughput = 125
+	gibibyte              = 1 << 30
+)
+
+// RecordsSource produces records of cluster resources other than pods for the beginTime-endTime interval; pods
+// are the pods running or deleted during the interval
+type RecordsSource interface {
+	GetRecords(pods []*v1.Pod, beginTime, endTime time.Time) []*usage.PodInfo
+}
+
+type VolumesInformer interface {
+	RecordsSource
+	Load(ctx context.Context, log *logrus.Entry, clientset kubernetes.Interface) error
+}
+
+type VolumesMap struct {
+	log     *logrus.Entry
+	cluster string
+	prices  price.StoragePrices
+	volumes corelisters.PersistentVolumeLister
+	claims  corelisters.PersistentVolumeClaimLister
+	classes storagelisters.StorageClassLister
+	// mu guards the volumes and claims deleted since the last records
+	mu             sync.Mutex
+	deletedVolumes []deletedVolume
+	deletedClaims  map[string]deletedClaim
+}
+
+// deletedVolume is the persistent volume deleted since the last records
+type deletedVolume struct {
+	pv      *v1.PersistentVolume
+	deleted time.Time
+}
+
+// deletedClaim is the claim deleted since the last records, by the bound volume name
+type deletedClaim struct {
+	namespace string
+	name      string
+	deleted   time.Time
+}
+
+func NewVolumesInformer(cluster string, prices price.StoragePrices) VolumesInformer {
+	return &VolumesMap{
+		cluster:       cluster,
+		prices:        prices,
+		deletedClaims: make(map[string]deletedClaim),
+	}
+}
+
+// Load starts PersistentVolume, PersistentVolumeClaim and StorageClass informers and waits for them to sync
+func (v *VolumesMap) Load(ctx context.Context, log *logrus.Entry, clientset kubernetes.Interface) error {
+	v.log = log
+	factory := informers.NewSharedInformerFactory(clientset, volumeCacheSyncPeriod)
+	volumes := factory.Core().V1().PersistentVolumes()
+	claims := factory.Core().V1().PersistentVolumeClaims()
+	v.volumes = volumes.Lister()
+	v.claims = claims.Lister()
+	v.classes = factory.Storage().V1().StorageClasses().Lister()
+	// deleted volumes and claims are reported till they were deleted
+	if _, err := volumes.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{DeleteFunc: v.deleteVolume}); err != nil {
+		return errors.Wrap(err, "adding persistent volume informer event handler")
+	}
+	if _, err := claims.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{DeleteFunc: v.deleteClaim}); err != nil {
+		return errors.Wrap(err, "adding persistent volume claim informer event handler")
+	}
+	factory.Start(ctx.Done())
+
+	log.Debug("waiting for volume informers to sync")
+	syncCtx, cancel := context.WithTimeout(ctx, cacheSyncTimeout)
+	defer cancel()
+	for _, synced := range factory.WaitForCacheSync(syncCtx.Done()) {
+		if !synced {
+			return ErrCacheSync
+		}
+	}
+	return nil
+}
+
+func (v *VolumesMap) deleteVolume(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pv, ok := obj.(*v1.PersistentVolume)
+	if !ok {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.deletedVolumes = append(v.deletedVolumes, deletedVolume{pv: pv, deleted: time.Now()})
+}
+
+func (v *VolumesMap) deleteClaim(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	claim, ok := obj.(*v1.PersistentVolumeClaim)
+	if !ok || claim.Spec.VolumeName == "" {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.deletedClaims[claim.Spec.VolumeName] = deletedClaim{namespace: claim.Namespace, name: claim.Name, deleted: time.Now()}
+}
+
+// takeDeleted returns the volumes and claims deleted since the last records and clears them
+func (v *VolumesMap) takeDeleted() ([]deletedVolume, map[string]deletedClaim) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	volumes, claims := v.deletedVolumes, v.deletedClaims
+	v.deletedVolumes = nil
+	v.deletedClaims = make(map[string]deletedClaim)
+	return volumes, claims
+}
+
+// GetRecords returns the persistent volume records with the pods consuming the volume claims during the interval,
+// including deleted pods; volumes and claims deleted during the interval are reported till they were deleted
+func (v *VolumesMap) GetRecords(pods []*v1.Pod, beginTime, endTime time.Time) []*usage.PodInfo {
+	volumes, err := v.volumes.List(labels.Everything())
+	if err != nil {
+		v.log.WithError(err).Error("listing persistent volumes")
+		return nil
+	}
+	deletedVolumes, deletedClaims := v.takeDeleted()
+	// pods consuming the claim by namespace/claim; a pod recreated under the same name is listed once
+	claimPods := make(map[string][]string)
+	for _, pod := range pods {
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil {
+				key := pod.Namespace + "/" + volume.PersistentVolumeClaim.ClaimName
+				if !contains(claimPods[key], pod.Name) {
+					claimPods[key] = append(claimPods[key], pod.Name)
+				}
+			}
+		}
+	}
+	records := make([]*usage.PodInfo, 0, len(volumes)+len(deletedVolumes))
+	for _, pv := range volumes {
+		records = append(records, v.volumeRecords(pv, claimPods, deletedClaims, beginTime, endTime)...)
+	}
+	for _, deleted := range deletedVolumes {
+		// final record of the volume deleted during the interval
+		deletedTime := deleted.deleted
+		if deletedTime.After(endTime) {
+			deletedTime = endTime
+		}
+		records = append(records, v.volumeRecords(deleted.pv, claimPods, deletedClaims, beginTime, deletedTime)...)
+	}
+	return records
+}
+
+// volumeRecords returns the volume records for the beginTime-endTime interval: the claim deleted during the
+// interval is charged till it was deleted and the current claim, if any, since then
+func (v *VolumesMap) volumeRecords(pv *v1.PersistentVolume, claimPods map[string][]string, deletedClaims map[string]deletedClaim, beginTime, endTime time.Time) []*usage.PodInfo {
+	var records []*usage.PodInfo
+	if claim, ok := deletedClaims[pv.Name]; ok && claim.deleted.After(beginTime) {
+		claimEndTime := claim.deleted
+		if claimEndTime.After(endTime) {
+			claimEndTime = endTime
+		}
+		volume := v.volumeInfo(pv)
+		volume.Claim = claim.name
+		volume.Pods = claimPods[claim.namespace+"/"+claim.name]
+		records = append(records, usage.GetVolumeInfo(v.cluster, pv.Name, claim.namespace, pv.CreationTimestamp.Time, volume, beginTime, claimEndTime))
+		beginTime = claimEndTime
+	}
+	if !endTime.After(beginTime) {
+		return records
+	}
+	volume := v.volumeInfo(pv)
+	namespace := ""
+	// bound claim, the claim reference of released volume is stale
+	if ref := pv.Spec.ClaimRef; ref != nil {
+		claim, err := v.claims.PersistentVolumeClaims(ref.Namespace).Get(ref.Name)
+		if err == nil && claim.Spec.VolumeName == pv.Name {
+			namespace = ref.Namespace
+			volume.Claim = ref.Name
+			volume.Pods = claimPods[ref.Namespace+"/"+ref.Name]
+		}
+	}
+	return append(records, usage.GetVolumeInfo(v.cluster, pv.Name, namespace, pv.CreationTimestamp.Time, volume, beginTime, endTime))
+}
+
+// volumeInfo resolves the volume type, provisioned IOPS and throughput from the volume source and storage class
+// parameters and prices the volume; EFS volumes are metered by stored bytes and not priced
+func (v *VolumesMap) volumeInfo(pv *v1.PersistentVolume) *usage.VolumeInfo {
+	volume := &usage.VolumeInfo{
+		StorageClass: pv.Spec.StorageClassName,
+		Provisioner:  pv.Annotations[provisionedByAnnotation],
+		Size:         pv.Spec.Capacity.Storage().Value(),
+	}
+	var parameters map[string]string
+	if class, err := v.classes.Get(pv.Spec.StorageClassName); err == nil {
+		volume.Provisioner = class.Provisioner
+		parameters = class.Parameters
+	}
+	switch {
+	case pv.Spec.CSI != nil && pv.Spec.CSI.Driver == efsCSIDriver:
+		volume.VolumeType = price.VolumeTypeEFS
+	case pv.Spec.CSI != nil && pv.Spec.CSI.Driver == ebsCSIDriver:
+		volume.VolumeType = strings.ToLower(parameter(parameters, "type", "gp3"))
+	case pv.Spec.AWSElasticBlockStore != nil || volume.Provisioner == ebsInTreeProvisioner:
+		volume.VolumeType = strings.ToLower(parameter(parameters, "type", "gp2"))
+	}
+	volume.IOPS = provisionedIOPS(volume.VolumeType, parameters, volume.Size)
+	volume.Throughput = provisionedThroughput(volume.VolumeType, parameters)
+	if cost, ok := v.prices.HourlyPrice(volume.VolumeType, volume.Size, volume.IOPS, volume.Throughput); ok {
+		volume.HourlyCost = cost
+	}
+	return volume
+}
+
+// provisionedIOPS returns the EBS volume IOPS from storage class parameters: iops, iopsPerGB or gp3 baseline
+func provisionedIOPS(volumeType string, parameters map[string]string, size int64) int64 {
+	if iops, err := strconv.ParseInt(parameter(parameters, "iops", ""), 10, 64); err == nil {
+		return iops
+	}
+	if perGB, err := strconv.ParseInt(parameter(parameters, "iopsPerGB", ""), 10, 64); err == nil {
+		return perGB * size / gibibyte
+	}
+	if volumeType == "gp3" {
+		return gp3BaselineIOPS
+	}
+	return 0
+}
+
+// provisionedThroughput returns the EBS volume throughput in MiB/s from storage class parameters or gp3 baseline
+func provisionedThroughput(volumeType string, parameters map[string]string) int64 {
+	if throughput, err := strconv.ParseInt(parameter(parameters, "throughput", ""), 10, 64); err == nil {
+		return throughput
+	}
+	if volumeType == "gp3" {
+		return gp3BaselineThroughput
+	}
+	return 0
+}
+
+// contains checks if the names include the name
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parameter returns the storage class parameter value, parameter keys are case-insensitive
+func parameter(parameters map[string]string, key, defaultValue string) string {
+	for k, value := range parameters {
+		if strings.EqualFold(k, key) {
+			return value
+		}
+	}
+	return defaultValue
+}
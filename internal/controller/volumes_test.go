@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/doitintl/eks-lens-agent/internal/aws/price"
+	"github.com/doitintl/eks-lens-agent/internal/usage"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newPersistentVolume(name, class string, size string, source v1.PersistentVolumeSource, claim *v1.ObjectReference) *v1.PersistentVolume {
+	return &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1.PersistentVolumeSpec{
+			StorageClassName:       class,
+			Capacity:               v1.ResourceList{v1.ResourceStorage: resource.MustParse(size)},
+			PersistentVolumeSource: source,
+			ClaimRef:               claim,
+		},
+	}
+}
+
+func TestVolumesMapGetRecords(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ebs := v1.PersistentVolumeSource{CSI: &v1.CSIPersistentVolumeSource{Driver: ebsCSIDriver}}
+	efs := v1.PersistentVolumeSource{CSI: &v1.CSIPersistentVolumeSource{Driver: efsCSIDriver}}
+	clientset := fake.NewSimpleClientset(
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "io2"},
+			Provisioner: ebsCSIDriver,
+			Parameters:  map[string]string{"type": "io2", "iopsPerGB": "50"},
+		},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "gp3"},
+			Provisioner: ebsCSIDriver,
+		},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "gp3-fast"},
+			Provisioner: ebsCSIDriver,
+			Parameters:  map[string]string{"type": "gp3", "throughput": "250"},
+		},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "efs"},
+			Provisioner: efsCSIDriver,
+		},
+		newPersistentVolume("pv-db", "io2", "100Gi", ebs, &v1.ObjectReference{Namespace: "team-a", Name: "data-db-0"}),
+		newPersistentVolume("pv-released", "gp3", "10Gi", ebs, &v1.ObjectReference{Namespace: "team-a", Name: "deleted"}),
+		newPersistentVolume("pv-shared", "efs", "5Gi", efs, nil),
+		newPersistentVolume("pv-fast", "gp3-fast", "100Gi", ebs, nil),
+		&v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "data-db-0"},
+			Spec:       v1.PersistentVolumeClaimSpec{VolumeName: "pv-db"},
+		},
+	)
+	dbPod := func(uid types.UID) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "db-0", UID: uid},
+			Spec: v1.PodSpec{Volumes: []v1.Volume{{
+				Name:         "data",
+				VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "data-db-0"}},
+			}}},
+		}
+	}
+	// StatefulSet pod deleted and recreated under the same name during the interval
+	pods := []*v1.Pod{dbPod("uid-1"), dbPod("uid-2")}
+
+	volumesInformer := NewVolumesInformer("test-cluster", price.DefaultStoragePrices())
+	err := volumesInformer.Load(ctx, logrus.NewEntry(logrus.New()), clientset)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	records := volumesInformer.GetRecords(pods, now.Add(-time.Hour), now)
+	assert.Len(t, records, 4)
+	byName := make(map[string]*usage.PodInfo)
+	for _, record := range records {
+		assert.Equal(t, usage.RecordTypeVolume, record.RecordType)
+		byName[record.Name] = record
+	}
+
+	// bound io2 volume with provisioned IOPS and consuming pod
+	db := byName["pv-db"]
+	assert.Equal(t, "team-a", db.Namespace)
+	assert.Equal(t, "io2", db.Volume.VolumeType)
+	assert.Equal(t, ebsCSIDriver, db.Volume.Provisioner)
+	assert.Equal(t, int64(5000), db.Volume.IOPS)
+	assert.Equal(t, "data-db-0", db.Volume.Claim)
+	assert.Equal(t, []string{"db-0"}, db.Volume.Pods)
+	assert.InDelta(t, (100*0.125+5000*0.065)/730, db.Cost.Storage, 1e-9)
+
+	// released volume claim is stale
+	released := byName["pv-released"]
+	assert.Equal(t, usage.UnboundVolumeNamespace, released.Namespace)
+	assert.Equal(t, "gp3", released.Volume.VolumeType)
+	assert.Equal(t, int64(3000), released.Volume.IOPS)
+	assert.Equal(t, int64(125), released.Volume.Throughput)
+	assert.Empty(t, released.Volume.Claim)
+
+	// gp3 volume with throughput above the baseline
+	fast := byName["pv-fast"]
+	assert.Equal(t, int64(250), fast.Volume.Throughput)
+	assert.InDelta(t, (100*0.08+125*0.04)/730, fast.Cost.Storage, 1e-9)
+
+	// EFS volume is metered by stored bytes and not priced
+	shared := byName["pv-shared"]
+	assert.Equal(t, price.VolumeTypeEFS, shared.Volume.VolumeType)
+	assert.Zero(t, shared.Cost.Total)
+}
+
+func TestVolumesMapGetRecordsDeleted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ebs := v1.PersistentVolumeSource{CSI: &v1.CSIPersistentVolumeSource{Driver: ebsCSIDriver}}
+	// retained volume of the deleted claim
+	retained := newPersistentVolume("pv-retained", "gp2", "10Gi", ebs, &v1.ObjectReference{Namespace: "team-a", Name: "data"})
+	// deleted volume
+	deleted := newPersistentVolume("pv-deleted", "gp2", "10Gi", ebs, nil)
+	clientset := fake.NewSimpleClientset(retained)
+
+	volumesInformer := NewVolumesInformer("test-cluster", price.DefaultStoragePrices())
+	err := volumesInformer.Load(ctx, logrus.NewEntry(logrus.New()), clientset)
+	assert.NoError(t, err)
+	volumes := volumesInformer.(*VolumesMap)
+
+	beginTime := time.Now().Add(-time.Hour)
+	volumes.deleteClaim(&v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "data"},
+		Spec:       v1.PersistentVolumeClaimSpec{VolumeName: retained.Name},
+	})
+	volumes.deleteVolume(deleted)
+	endTime := time.Now().Add(time.Hour)
+
+	records := volumes.GetRecords(nil, beginTime, endTime)
+	assert.Len(t, records, 3)
+	byNamespace := make(map[string][]*usage.PodInfo)
+	for _, record := range records {
+		byNamespace[record.Namespace] = append(byNamespace[record.Namespace], record)
+	}
+
+	// the deleted claim is charged till it was deleted and the released volume since then
+	claimed := byNamespace["team-a"]
+	assert.Len(t, claimed, 1)
+	assert.Equal(t, retained.Name, claimed[0].Name)
+	assert.Equal(t, "data", claimed[0].Volume.Claim)
+	assert.Equal(t, beginTime, claimed[0].BeginTime)
+	assert.True(t, claimed[0].EndTime.Before(endTime))
+	unbound := byNamespace[usage.UnboundVolumeNamespace]
+	assert.Len(t, unbound, 2)
+	for _, record := range unbound {
+		switch record.Name {
+		case retained.Name:
+			assert.Equal(t, claimed[0].EndTime, record.BeginTime)
+			assert.Equal(t, endTime, record.EndTime)
+		case deleted.Name:
+			// final record of the deleted volume
+			assert.Equal(t, beginTime, record.BeginTime)
+			assert.True(t, record.EndTime.Before(endTime))
+			assert.Positive(t, record.Cost.Storage)
+		default:
+			t.Errorf("unexpected volume record %s", record.Name)
+		}
+	}
+
+	// deleted volumes and claims are reported once
+	assert.Len(t, volumes.GetRecords(nil, endTime, endTime.Add(time.Hour)), 1)
+}
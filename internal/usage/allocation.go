@@ -0,0 +1,91 @@
+package usage
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// AllocationModelRequests allocates the node cost by requested resources
+	AllocationModelRequests = "requests"
+	// AllocationModelUsage allocates the node cost by average used resources
+	AllocationModelUsage = "usage"
+	// AllocationModelMax allocates the node cost by the greater of requested and average used resources
+	AllocationModelMax = "max"
+	// AllocationModelBlend allocates the node cost by the weighted blend of requested and average used resources
+	AllocationModelBlend = "blend"
+)
+
+// AllocationModel selects the resources the node cost is allocated by
+type AllocationModel struct {
+	// Name: requests, usage, max or blend
+	Name string
+	// UsageWeight is the weight of used resources in the blend model, between 0 and 1
+	UsageWeight float64
+}
+
+// Apply sets the record allocated resources and cost by the allocation model; records without usage
+// samples are allocated by requests
+func (m AllocationModel) Apply(record *PodInfo) {
+	requests := record.Resources.Requests
+	allocated := requests
+	model := AllocationModelRequests
+	if used := record.Usage; used != nil && m.Name != AllocationModelRequests && m.Name != "" {
+		model = m.Name
+		// GPU usage is not measured, GPUs are allocated by requests
+		switch m.Name {
+		case AllocationModelUsage:
+			allocated.CPU = used.CPUAvg
+			allocated.Memory = used.MemoryAvg
+		case AllocationModelMax:
+			if used.CPUAvg > allocated.CPU {
+				allocated.CPU = used.CPUAvg
+			}
+			if used.MemoryAvg > allocated.Memory {
+				allocated.Memory = used.MemoryAvg
+			}
+		case AllocationModelBlend:
+			allocated.CPU = blend(requests.CPU, used.CPUAvg, m.UsageWeight)
+			allocated.Memory = blend(requests.Memory, used.MemoryAvg, m.UsageWeight)
+		default:
+			model = AllocationModelRequests
+		}
+	}
+	record.AllocationModel = model
+	record.Resources.Allocated = allocated
+	record.Cost = GetPodCost(allocated, record.Node.Cost, record.BeginTime, record.EndTime)
+}
+
+func blend(requested, used int64, usageWeight float64) int64 {
+	return int64(math.Round((1-usageWeight)*float64(requested) + usageWeight*float64(used)))
+}
+
+// NormalizeAllocated scales down the CPU and memory allocated to the node pod records when, averaged over the
+// beginTime-endTime interval, they exceed the node allocatable, e.g. pods using more than requested under the usage
+// and max models, and updates the records cost; the node cost is allocated at most once
+func NormalizeAllocated(node *NodeInfo, pods []*PodInfo, beginTime, endTime time.Time) {
+	nodeBeginTime := beginTime
+	if node.Created.After(beginTime) {
+		nodeBeginTime = node.Created
+	}
+	allocated := averageAllocated(pods, nodeBeginTime, endTime)
+	cpuScale := allocatedScale(node.Allocatable.CPU, allocated.cpu)
+	memoryScale := allocatedScale(node.Allocatable.Memory, allocated.memory)
+	if cpuScale == 1 && memoryScale == 1 {
+		return
+	}
+	for _, record := range pods {
+		// round down so the scaled allocation does not exceed the node allocatable
+		record.Resources.Allocated.CPU = int64(float64(record.Resources.Allocated.CPU) * cpuScale)
+		record.Resources.Allocated.Memory = int64(float64(record.Resources.Allocated.Memory) * memoryScale)
+		record.Cost = GetPodCost(record.Resources.Allocated, record.Node.Cost, record.BeginTime, record.EndTime)
+	}
+}
+
+// allocatedScale returns the factor to scale allocated resource down to allocatable, 1 if it fits
+func allocatedScale(allocatable int64, allocated float64) float64 {
+	if allocatable <= 0 || allocated <= float64(allocatable) {
+		return 1
+	}
+	return float64(allocatable) / allocated
+}
@@ -0,0 +1,103 @@
+package usage
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAllocationModelApply(t *testing.T) {
+	beginTime := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	requests := Ask{CPU: 500, Memory: 1 << 30, GPU: 1}
+	used := &ResourceUsage{CPUAvg: 1500, CPUPeak: 2000, MemoryAvg: 512 << 20, MemoryPeak: 1 << 30, Samples: 15}
+	tests := []struct {
+		name      string
+		model     AllocationModel
+		usage     *ResourceUsage
+		wantModel string
+		want      Ask
+	}{
+		{name: "requests", model: AllocationModel{Name: AllocationModelRequests}, usage: used, wantModel: AllocationModelRequests, want: requests},
+		{name: "usage", model: AllocationModel{Name: AllocationModelUsage}, usage: used, wantModel: AllocationModelUsage, want: Ask{CPU: 1500, Memory: 512 << 20, GPU: 1}},
+		{name: "max", model: AllocationModel{Name: AllocationModelMax}, usage: used, wantModel: AllocationModelMax, want: Ask{CPU: 1500, Memory: 1 << 30, GPU: 1}},
+		{name: "blend", model: AllocationModel{Name: AllocationModelBlend, UsageWeight: 0.25}, usage: used, wantModel: AllocationModelBlend, want: Ask{CPU: 750, Memory: 896 << 20, GPU: 1}},
+		{name: "usage without samples", model: AllocationModel{Name: AllocationModelUsage}, wantModel: AllocationModelRequests, want: requests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := &PodInfo{
+				Resources: Resources{Requests: requests},
+				Usage:     tt.usage,
+				Node:      NodeInfo{Cost: Cost{VCPUHour: 0.04, MemoryHour: 0.005, GPUHour: 0.9}},
+				BeginTime: beginTime,
+				EndTime:   beginTime.Add(time.Hour),
+			}
+			tt.model.Apply(record)
+			if record.AllocationModel != tt.wantModel {
+				t.Errorf("Apply() model = %v, want %v", record.AllocationModel, tt.wantModel)
+			}
+			if !reflect.DeepEqual(record.Resources.Allocated, tt.want) {
+				t.Errorf("Apply() allocated = %+v, want %+v", record.Resources.Allocated, tt.want)
+			}
+			want := GetPodCost(tt.want, record.Node.Cost, record.BeginTime, record.EndTime)
+			if math.Abs(record.Cost.Total-want.Total) > 1e-9 {
+				t.Errorf("Apply() cost = %+v, want %+v", record.Cost, want)
+			}
+		})
+	}
+}
+
+func TestNormalizeAllocated(t *testing.T) {
+	beginTime := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	endTime := beginTime.Add(time.Hour)
+	node := &NodeInfo{
+		Allocatable: Capacity{CPU: 2000, Memory: 4 << 30},
+		Cost:        Cost{VCPUHour: 0.04, MemoryHour: 0.005},
+	}
+	record := func(allocated Ask, begin time.Time) *PodInfo {
+		return &PodInfo{
+			Resources: Resources{Allocated: allocated},
+			Node:      *node,
+			BeginTime: begin,
+			EndTime:   endTime,
+		}
+	}
+	tests := []struct {
+		name string
+		pods []*PodInfo
+		want []Ask
+	}{
+		{
+			name: "fits allocatable",
+			pods: []*PodInfo{record(Ask{CPU: 1000, Memory: 1 << 30}, beginTime), record(Ask{CPU: 1000, Memory: 3 << 30}, beginTime)},
+			want: []Ask{{CPU: 1000, Memory: 1 << 30}, {CPU: 1000, Memory: 3 << 30}},
+		},
+		{
+			name: "cpu usage exceeds allocatable",
+			pods: []*PodInfo{record(Ask{CPU: 3000, Memory: 1 << 30}, beginTime), record(Ask{CPU: 1000, Memory: 1 << 30}, beginTime)},
+			want: []Ask{{CPU: 1500, Memory: 1 << 30}, {CPU: 500, Memory: 1 << 30}},
+		},
+		{
+			name: "time weighted memory exceeds allocatable",
+			pods: []*PodInfo{record(Ask{CPU: 500, Memory: 4 << 30}, beginTime), record(Ask{CPU: 500, Memory: 4 << 30}, beginTime.Add(30*time.Minute))},
+			want: []Ask{{CPU: 500, Memory: 8 << 30 / 3}, {CPU: 500, Memory: 8 << 30 / 3}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			NormalizeAllocated(node, tt.pods, beginTime, endTime)
+			var total float64
+			for i, pod := range tt.pods {
+				if !reflect.DeepEqual(pod.Resources.Allocated, tt.want[i]) {
+					t.Errorf("NormalizeAllocated() allocated = %+v, want %+v", pod.Resources.Allocated, tt.want[i])
+				}
+				total += pod.Cost.Total
+			}
+			// pods are allocated at most the node allocatable cost
+			if nodeCost := GetPodCost(Ask{CPU: node.Allocatable.CPU, Memory: node.Allocatable.Memory}, node.Cost, beginTime, endTime); total > nodeCost.Total+1e-9 {
+				t.Errorf("NormalizeAllocated() pods cost = %v, exceeds node cost %v", total, nodeCost.Total)
+			}
+		})
+	}
+}
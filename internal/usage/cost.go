@@ -0,0 +1,144 @@
+package usage
+
+import (
+	"strings"
+)
+
+const (
+	// bytes in GiB
+	gibibyte = 1 << 30
+	// millicores in vCPU
+	millicores = 1000
+)
+
+// The cost allocation data uses relative unit weights for CPU and memory based on a 9:1 ratio.
+// For GPU, the unit weight depends on the GPU type.
+// This is derived from per vCPU per hour and per GB per hour prices in AWS Fargate
+// http://aws.amazon.com/fargate/pricing/ and GPU instance prices.
+const (
+	DefaultCPUWeight    = 9
+	DefaultMemoryWeight = 1
+	// DefaultGPUWeight is used for GPU instance families missing from the GPU weights table;
+	// it sits between NVIDIA T4 (g4dn) and NVIDIA A10G (g5) weights
+	DefaultGPUWeight = 100
+)
+
+// DefaultGPUWeights maps instance family to GPU unit weight
+var DefaultGPUWeights = map[string]float64{
+	"g4ad": 43,  // AMD Radeon Pro V520
+	"p4d":  625, // NVIDIA A100
+	"p4de": 625, // NVIDIA A100
+	"g5":   200, // NVIDIA A10G
+	"g2":   57,  // NVIDIA K520
+	"g4dn": 63,  // NVIDIA T4
+	"g5g":  70,  // NVIDIA T4G
+	"p2":   140, // NVIDIA K80
+	"g3":   120, // NVIDIA M60
+	"g3s":  120, // NVIDIA M60
+	"p3":   632, // NVIDIA V100
+	"p3dn": 632, // NVIDIA V100
+}
+
+// Weights are the relative unit weights of vCPU, GiB of memory and GPU
+type Weights struct {
+	CPU    float64
+	Memory float64
+	// GPU weights by instance family, e.g. "g5"
+	GPU map[string]float64
+	// DefaultGPU weight for instance families missing from GPU weights
+	DefaultGPU float64
+	// Extended resources weights or prices by resource name, e.g. "aws.amazon.com/neuron";
+	// extended resources without rate are tracked but not charged
+	Extended map[string]ExtendedRate
+}
+
+// DefaultWeights returns the default 9:1 CPU/memory weights and GPU weights by instance family
+func DefaultWeights() Weights {
+	gpu := make(map[string]float64, len(DefaultGPUWeights))
+	for family, weight := range DefaultGPUWeights {
+		gpu[family] = weight
+	}
+	return Weights{
+		CPU:        DefaultCPUWeight,
+		Memory:     DefaultMemoryWeight,
+		GPU:        gpu,
+		DefaultGPU: DefaultGPUWeight,
+		Extended:   make(map[string]ExtendedRate),
+	}
+}
+
+// GPUWeight returns the GPU weight for the instance type family, e.g. "g5" for "g5.xlarge"
+func (w Weights) GPUWeight(instanceType string) float64 {
+	family := instanceType
+	if i := strings.Index(instanceType, "."); i >= 0 {
+		family = instanceType[:i]
+	}
+	if weight, ok := w.GPU[family]; ok {
+		return weight
+	}
+	return w.DefaultGPU
+}
+
+// FixedHour returns the hourly price of the resources with a fixed price, carved out of the instance cost
+func FixedHour(resources Capacity, weights Weights) float64 {
+	fixed := 0.0
+	for name, value := range resources.Extended {
+		if rate, ok := weights.Extended[name]; ok && rate.Price > 0 && value > 0 {
+			fixed += rate.Price * float64(value)
+		}
+	}
+	return fixed
+}
+
+// NewCost splits the instance hourly cost between allocatable vCPU, GiB of memory, GPU and weighted extended
+// resources using the unit weights, after carving out the fixed price of priced extended resources; fixed prices
+// exceeding the instance cost are scaled down to it, so the node is not charged more than it costs
+func NewCost(instanceHour float64, instanceType string, allocatable Capacity, weights Weights) Cost {
+	cost := Cost{InstanceHour: instanceHour}
+	gpuWeight := 0.0
+	if allocatable.GPU > 0 {
+		gpuWeight = weights.GPUWeight(instanceType)
+	}
+	fixedScale := 1.0
+	if fixed := FixedHour(allocatable, weights); fixed > instanceHour {
+		fixedScale = instanceHour / fixed
+	}
+	remaining := instanceHour
+	extendedUnits := 0.0
+	for name, value := range allocatable.Extended {
+		rate, ok := weights.Extended[name]
+		if !ok || value <= 0 {
+			continue
+		}
+		if cost.ExtendedHour == nil {
+			cost.ExtendedHour = make(map[string]float64)
+		}
+		if rate.Price > 0 {
+			cost.ExtendedHour[name] = rate.Price * fixedScale
+			remaining -= cost.ExtendedHour[name] * float64(value)
+			continue
+		}
+		extendedUnits += rate.Weight * float64(value)
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+	// Unit-cost-per-resource = Hourly-instance-cost/((Memory-weight * Memory-available) + (CPU-weight * CPU-available) + (GPU-weight * GPU-available))
+	units := weights.Memory*float64(allocatable.Memory)/gibibyte +
+		weights.CPU*float64(allocatable.CPU)/millicores +
+		gpuWeight*float64(allocatable.GPU) +
+		extendedUnits
+	if units <= 0 {
+		return cost
+	}
+	cost.UnitCostResource = remaining / units
+	cost.VCPUHour = weights.CPU * cost.UnitCostResource
+	cost.MemoryHour = weights.Memory * cost.UnitCostResource
+	cost.GPUHour = gpuWeight * cost.UnitCostResource
+	for name := range allocatable.Extended {
+		if rate, ok := weights.Extended[name]; ok && rate.Price <= 0 {
+			cost.ExtendedHour[name] = rate.Weight * cost.UnitCostResource
+		}
+	}
+	return cost
+}
@@ -0,0 +1,165 @@
+package usage
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewCost(t *testing.T) {
+	const epsilon = 1e-9
+	tests := []struct {
+		name         string
+		instanceHour float64
+		instanceType string
+		allocatable  Capacity
+		want         Cost
+	}{
+		{
+			name:         "m5.large without GPU",
+			instanceHour: 0.096,
+			instanceType: "m5.large",
+			allocatable: Capacity{
+				CPU:    2000,         // 2 vCPU
+				Memory: 8 * gibibyte, // 8Gi
+			},
+			// units = 9 * 2 + 1 * 8 = 26
+			want: Cost{
+				InstanceHour:     0.096,
+				UnitCostResource: 0.096 / 26,
+				VCPUHour:         9 * 0.096 / 26,
+				MemoryHour:       0.096 / 26,
+			},
+		},
+		{
+			name:         "g5.xlarge with known GPU family",
+			instanceHour: 1.006,
+			instanceType: "g5.xlarge",
+			allocatable: Capacity{
+				CPU:    4000,          // 4 vCPU
+				Memory: 16 * gibibyte, // 16Gi
+				GPU:    1,
+			},
+			// units = 9 * 4 + 1 * 16 + 200 * 1 = 252
+			want: Cost{
+				InstanceHour:     1.006,
+				UnitCostResource: 1.006 / 252,
+				VCPUHour:         9 * 1.006 / 252,
+				MemoryHour:       1.006 / 252,
+				GPUHour:          200 * 1.006 / 252,
+			},
+		},
+		{
+			name:         "unknown GPU family falls back to default GPU weight",
+			instanceHour: 1.0,
+			instanceType: "x99.xlarge",
+			allocatable: Capacity{
+				CPU:    4000,          // 4 vCPU
+				Memory: 16 * gibibyte, // 16Gi
+				GPU:    1,
+			},
+			// units = 9 * 4 + 1 * 16 + 100 * 1 = 152
+			want: Cost{
+				InstanceHour:     1.0,
+				UnitCostResource: 1.0 / 152,
+				VCPUHour:         9.0 / 152,
+				MemoryHour:       1.0 / 152,
+				GPUHour:          100.0 / 152,
+			},
+		},
+		{
+			name:         "no allocatable resources",
+			instanceHour: 0.5,
+			instanceType: "m5.large",
+			want:         Cost{InstanceHour: 0.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewCost(tt.instanceHour, tt.instanceType, tt.allocatable, DefaultWeights())
+			if got.InstanceHour != tt.want.InstanceHour {
+				t.Errorf("NewCost().InstanceHour = %v, want %v", got.InstanceHour, tt.want.InstanceHour)
+			}
+			if math.Abs(got.UnitCostResource-tt.want.UnitCostResource) > epsilon {
+				t.Errorf("NewCost().UnitCostResource = %v, want %v", got.UnitCostResource, tt.want.UnitCostResource)
+			}
+			if math.Abs(got.VCPUHour-tt.want.VCPUHour) > epsilon {
+				t.Errorf("NewCost().VCPUHour = %v, want %v", got.VCPUHour, tt.want.VCPUHour)
+			}
+			if math.Abs(got.MemoryHour-tt.want.MemoryHour) > epsilon {
+				t.Errorf("NewCost().MemoryHour = %v, want %v", got.MemoryHour, tt.want.MemoryHour)
+			}
+			if math.Abs(got.GPUHour-tt.want.GPUHour) > epsilon {
+				t.Errorf("NewCost().GPUHour = %v, want %v", got.GPUHour, tt.want.GPUHour)
+			}
+		})
+	}
+}
+
+func TestWeightsGPUWeight(t *testing.T) {
+	weights := DefaultWeights()
+	weights.GPU["g5"] = 250
+	tests := []struct {
+		instanceType string
+		want         float64
+	}{
+		{instanceType: "g5.xlarge", want: 250},
+		{instanceType: "p4de.24xlarge", want: 625},
+		{instanceType: "g4dn", want: 63},
+		{instanceType: "inf2.xlarge", want: DefaultGPUWeight},
+	}
+	for _, tt := range tests {
+		if got := weights.GPUWeight(tt.instanceType); got != tt.want {
+			t.Errorf("GPUWeight(%s) = %v, want %v", tt.instanceType, got, tt.want)
+		}
+	}
+	// default weights are not changed by overrides
+	if DefaultGPUWeights["g5"] != 200 {
+		t.Errorf("DefaultGPUWeights[g5] = %v, want 200", DefaultGPUWeights["g5"])
+	}
+}
+
+func TestNewCostExtended(t *testing.T) {
+	const epsilon = 1e-9
+	weights := DefaultWeights()
+	weights.Extended["aws.amazon.com/neuron"] = ExtendedRate{Weight: 100}
+	weights.Extended["vpc.amazonaws.com/pod-eni"] = ExtendedRate{Price: 0.01}
+	allocatable := Capacity{
+		CPU:    4000,          // 4 vCPU
+		Memory: 16 * gibibyte, // 16Gi
+		Extended: map[string]int64{
+			"aws.amazon.com/neuron":     1,
+			"vpc.amazonaws.com/pod-eni": 9,
+			"hugepages-2Mi":             1 << 30,
+		},
+	}
+	// fixed price carved out: 0.852 - 9 * 0.01 = 0.762; units = 9 * 4 + 1 * 16 + 100 * 1 = 152
+	got := NewCost(0.852, "inf2.xlarge", allocatable, weights)
+	unit := 0.762 / 152
+	if math.Abs(got.UnitCostResource-unit) > epsilon {
+		t.Errorf("NewCost().UnitCostResource = %v, want %v", got.UnitCostResource, unit)
+	}
+	if math.Abs(got.ExtendedHour["aws.amazon.com/neuron"]-100*unit) > epsilon {
+		t.Errorf("NewCost().ExtendedHour[neuron] = %v, want %v", got.ExtendedHour["aws.amazon.com/neuron"], 100*unit)
+	}
+	if got.ExtendedHour["vpc.amazonaws.com/pod-eni"] != 0.01 {
+		t.Errorf("NewCost().ExtendedHour[pod-eni] = %v, want 0.01", got.ExtendedHour["vpc.amazonaws.com/pod-eni"])
+	}
+	// resources without rate are not charged
+	if _, ok := got.ExtendedHour["hugepages-2Mi"]; ok {
+		t.Errorf("NewCost().ExtendedHour[hugepages-2Mi] is set, want unset")
+	}
+	// whole node cost reconciles with the instance hourly cost
+	total := got.VCPUHour*4 + got.MemoryHour*16 + got.ExtendedHour["aws.amazon.com/neuron"] + got.ExtendedHour["vpc.amazonaws.com/pod-eni"]*9
+	if math.Abs(total-0.852) > epsilon {
+		t.Errorf("NewCost() node total = %v, want 0.852", total)
+	}
+
+	// fixed price above the instance cost is scaled down to it: 0.09 carved out of 0.06
+	got = NewCost(0.06, "inf2.xlarge", allocatable, weights)
+	if math.Abs(got.ExtendedHour["vpc.amazonaws.com/pod-eni"]-0.06/9) > epsilon {
+		t.Errorf("NewCost().ExtendedHour[pod-eni] = %v, want %v", got.ExtendedHour["vpc.amazonaws.com/pod-eni"], 0.06/9)
+	}
+	if got.VCPUHour != 0 || got.MemoryHour != 0 {
+		t.Errorf("NewCost() = %+v, want no cost left for CPU and memory", got)
+	}
+}
@@ -0,0 +1,74 @@
+package usage
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// ResourceGPU is the NVIDIA GPU resource, accounted in the GPU fields rather than the extended resources
+	ResourceGPU = "nvidia.com/gpu"
+	// attachable volumes limits are advertised by nodes but not requested by pods
+	attachableVolumesPrefix = "attachable-volumes-"
+)
+
+// ExtendedRate is the cost model of an extended resource: a relative unit weight, like GPU, splitting the instance
+// cost or a fixed hourly unit price carved out of the instance cost
+type ExtendedRate struct {
+	Weight float64
+	Price  float64
+}
+
+// getExtended returns the extended resources of the list (e.g. aws.amazon.com/neuron, nvidia.com/mig-1g.5gb,
+// vpc.amazonaws.com/pod-eni and hugepages), nil if none
+func getExtended(resources v1.ResourceList) map[string]int64 {
+	var result map[string]int64
+	for name, quantity := range resources {
+		if !isExtended(name) || quantity.IsZero() {
+			continue
+		}
+		if result == nil {
+			result = make(map[string]int64)
+		}
+		result[string(name)] = quantity.Value()
+	}
+	return result
+}
+
+func isExtended(name v1.ResourceName) bool {
+	switch name {
+	case v1.ResourceCPU, v1.ResourceMemory, v1.ResourcePods, v1.ResourceStorage, v1.ResourceEphemeralStorage, ResourceGPU:
+		return false
+	}
+	return !strings.HasPrefix(string(name), attachableVolumesPrefix)
+}
+
+// unrequestedExtended returns the allocatable extended resources not requested by pods, nil if none
+func unrequestedExtended(allocatable, requested map[string]int64) map[string]int64 {
+	var result map[string]int64
+	for name, value := range allocatable {
+		if idle := unrequested(value, requested[name]); idle > 0 {
+			if result == nil {
+				result = make(map[string]int64)
+			}
+			result[name] = idle
+		}
+	}
+	return result
+}
+
+// extendedAllocation returns the asked extended resources as a fraction of the node allocatable resources
+func extendedAllocation(asked, allocatable map[string]int64) map[string]float64 {
+	var result map[string]float64
+	for name, value := range asked {
+		if allocatable[name] <= 0 {
+			continue
+		}
+		if result == nil {
+			result = make(map[string]float64)
+		}
+		result[name] = float64(value) / float64(allocatable[name])
+	}
+	return result
+}
@@ -0,0 +1,196 @@
+package usage
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+/*
+Metadata policy file example; key patterns are globs or, with "re:" prefix, regular expressions:
+
+pods:
+  labels:
+    include: ["*"]
+    exclude: ["*-hash", "re:^secret\\..*"]
+  annotations:
+    include: ["example.com/cost-center"]
+namespaces:
+  labels:
+    include: ["team", "cost-center", "env"]
+nodes:
+  labels:
+    include: ["karpenter.sh/*"]
+rename:
+  app.kubernetes.io/name: app
+maxValueLength: 256
+*/
+
+const regexPrefix = "re:"
+
+var defaultMetadataPolicy = DefaultMetadataPolicy()
+
+// KeyFilter selects metadata keys matching any include pattern and no exclude pattern
+type KeyFilter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// MetadataRules selects labels and annotations of an object kind
+type MetadataRules struct {
+	Labels      KeyFilter `json:"labels"`
+	Annotations KeyFilter `json:"annotations"`
+}
+
+// MetadataPolicy selects the pod, namespace and node labels and annotations copied into records
+type MetadataPolicy struct {
+	Pods       MetadataRules `json:"pods"`
+	Namespaces MetadataRules `json:"namespaces"`
+	Nodes      MetadataRules `json:"nodes"`
+	// Rename maps captured keys to record keys
+	Rename map[string]string `json:"rename,omitempty"`
+	// MaxValueLength truncates longer values, zero for no limit
+	MaxValueLength int `json:"maxValueLength,omitempty"`
+}
+
+// DefaultMetadataPolicy returns the policy copying all pod labels except keys ending with "-hash"
+func DefaultMetadataPolicy() *MetadataPolicy {
+	policy := &MetadataPolicy{
+		Pods: MetadataRules{Labels: KeyFilter{Include: []string{"*"}, Exclude: []string{"*-hash"}}},
+	}
+	if err := policy.Compile(); err != nil {
+		panic(err)
+	}
+	return policy
+}
+
+// LoadMetadataPolicy loads the metadata policy from the YAML file over the default policy
+func LoadMetadataPolicy(file string) (*MetadataPolicy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading metadata policy")
+	}
+	policy := DefaultMetadataPolicy()
+	if err = yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, errors.Wrap(err, "parsing metadata policy")
+	}
+	if policy.MaxValueLength < 0 {
+		return nil, errors.New("invalid metadata policy max value length")
+	}
+	if err = policy.validateRename(); err != nil {
+		return nil, err
+	}
+	if err = policy.Compile(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// validateRename rejects keys renamed to the same record key: one value would overwrite the other
+func (p *MetadataPolicy) validateRename() error {
+	keys := make([]string, 0, len(p.Rename))
+	for key := range p.Rename {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	renamed := make(map[string]string, len(keys))
+	for _, key := range keys {
+		target := p.Rename[key]
+		if other, ok := renamed[target]; ok {
+			return errors.Errorf("invalid metadata policy: keys %s and %s are both renamed to %s", other, key, target)
+		}
+		renamed[target] = key
+	}
+	return nil
+}
+
+// Compile compiles the policy key patterns; call it after changing the patterns
+func (p *MetadataPolicy) Compile() error {
+	for _, filter := range []*KeyFilter{
+		&p.Pods.Labels, &p.Pods.Annotations,
+		&p.Namespaces.Labels, &p.Namespaces.Annotations,
+		&p.Nodes.Labels, &p.Nodes.Annotations,
+	} {
+		var err error
+		if filter.include, err = compilePatterns(filter.Include); err != nil {
+			return err
+		}
+		if filter.exclude, err = compilePatterns(filter.Exclude); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Capture returns the values selected by the filter, renamed and truncated by the policy; nil if none
+func (p *MetadataPolicy) Capture(filter *KeyFilter, values map[string]string) map[string]string {
+	var result map[string]string
+	for key, value := range values {
+		if !filter.Match(key) {
+			continue
+		}
+		if renamed, ok := p.Rename[key]; ok {
+			key = renamed
+		}
+		if p.MaxValueLength > 0 && len(value) > p.MaxValueLength {
+			value = truncate(value, p.MaxValueLength)
+		}
+		if result == nil {
+			result = make(map[string]string)
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// truncate cuts the value to at most length bytes at a rune boundary, not splitting multibyte characters
+func truncate(value string, length int) string {
+	for length > 0 && !utf8.RuneStart(value[length]) {
+		length--
+	}
+	return value[:length]
+}
+
+// Empty returns true if the filter selects no keys
+func (f *KeyFilter) Empty() bool {
+	return len(f.include) == 0
+}
+
+// Match returns true if the key matches any include pattern and no exclude pattern
+func (f *KeyFilter) Match(key string) bool {
+	return matchAny(f.include, key) && !matchAny(f.exclude, key)
+}
+
+func matchAny(patterns []*regexp.Regexp, key string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// compilePatterns compiles globs ("*" matches any characters, "?" matches one) and "re:" regular expressions
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	result := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		expr := strings.TrimPrefix(pattern, regexPrefix)
+		if expr == pattern {
+			expr = "^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(pattern)) + "$"
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid metadata key pattern %q", pattern)
+		}
+		result = append(result, re)
+	}
+	return result, nil
+}
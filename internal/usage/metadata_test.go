@@ -0,0 +1,97 @@
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMetadataPolicyCapture(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "metadata.yaml")
+	data := `pods:
+  labels:
+    include: ["*"]
+    exclude: ["*-hash", "re:^secret\\..*"]
+  annotations:
+    include: ["example.com/cost-center"]
+nodes:
+  labels:
+    include: ["karpenter.sh/*"]
+rename:
+  app.kubernetes.io/name: app
+maxValueLength: 5
+`
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadMetadataPolicy(file)
+	if err != nil {
+		t.Fatalf("LoadMetadataPolicy() error = %v", err)
+	}
+	tests := []struct {
+		name   string
+		filter *KeyFilter
+		values map[string]string
+		want   map[string]string
+	}{
+		{
+			name:   "pod labels",
+			filter: &policy.Pods.Labels,
+			values: map[string]string{
+				"app.kubernetes.io/name": "web",
+				"pod-template-hash":      "5d9f",
+				"secret.example.com/key": "value",
+				"version":                "v1.2.3",
+				"team":                   "abcd€",
+			},
+			// multibyte characters are not split
+			want: map[string]string{"app": "web", "version": "v1.2.", "team": "abcd"},
+		},
+		{
+			name:   "pod annotations allowlist",
+			filter: &policy.Pods.Annotations,
+			values: map[string]string{"example.com/cost-center": "cc-1", "kubectl.kubernetes.io/last-applied-configuration": "{}"},
+			want:   map[string]string{"example.com/cost-center": "cc-1"},
+		},
+		{
+			name:   "node labels glob",
+			filter: &policy.Nodes.Labels,
+			values: map[string]string{"karpenter.sh/nodepool": "batch", "kubernetes.io/os": "linux"},
+			want:   map[string]string{"karpenter.sh/nodepool": "batch"},
+		},
+		{
+			name:   "namespace labels not captured",
+			filter: &policy.Namespaces.Labels,
+			values: map[string]string{"team": "a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Capture(tt.filter, tt.values); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Capture() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMetadataPolicyInvalidPattern(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "metadata.yaml")
+	if err := os.WriteFile(file, []byte("pods:\n  labels:\n    include: [\"re:(\"]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadMetadataPolicy(file); err == nil {
+		t.Error("LoadMetadataPolicy() error = nil, want invalid pattern error")
+	}
+}
+
+func TestLoadMetadataPolicyRenameCollision(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "metadata.yaml")
+	data := "rename:\n  app.kubernetes.io/name: app\n  k8s-app: app\n"
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadMetadataPolicy(file); err == nil {
+		t.Error("LoadMetadataPolicy() error = nil, want rename collision error")
+	}
+}
@@ -1,6 +1,8 @@
 package usage
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"math"
 	"strconv"
@@ -15,32 +17,38 @@ import (
 
 const (
 	fargateType = "fargate"
+	// ComputeTypeFargate is the compute type of Fargate nodes
+	ComputeTypeFargate = fargateType
+	// CapacityTypeSpot is the capacity type of EC2 spot instances
+	CapacityTypeSpot = "SPOT"
+	// CapacityTypeOnDemand is the capacity type of EC2 on-demand instances
+	CapacityTypeOnDemand = "ON_DEMAND"
+	// RecordTypePod is the record type of pod records
+	RecordTypePod = "pod"
+	// RecordTypeIdle is the record type of node idle capacity records
+	RecordTypeIdle = "idle"
+	// RecordTypeOverhead is the record type of node system-reserved overhead records
+	RecordTypeOverhead = "overhead"
+	// RecordTypeClusterFee is the record type of EKS control plane fee records
+	RecordTypeClusterFee = "cluster_fee"
+	// IdleNamespace and IdleName are the reserved namespace and name of node idle capacity records
+	IdleNamespace = "__idle__"
+	IdleName      = "__idle__"
+	// OverheadNamespace and OverheadName are the reserved namespace and name of node overhead records
+	OverheadNamespace = "__overhead__"
+	OverheadName      = "__overhead__"
+	// ClusterFeeNamespace and ClusterFeeName are the reserved namespace and name of EKS control plane fee records;
+	// namespace share of the split fee has the namespace name
+	ClusterFeeNamespace = "__cluster__"
+	ClusterFeeName      = "__control_plane__"
+	// OverheadPolicyNone keeps node overhead in the allocatable resources unit costs
+	OverheadPolicyNone = "none"
+	// OverheadPolicyProportional spreads node overhead across the node pods proportionally to their cost
+	OverheadPolicyProportional = "proportional"
+	// OverheadPolicyPlatform assigns node overhead to the platform cost center overhead record
+	OverheadPolicyPlatform = "platform"
 )
 
-// The cost allocation data uses relative unit weights for CPU and memory based on a 9:1 ratio.
-// For GPU, the unit weight depends on the GPU type.
-// This is derived from per vCPU per hour and per GB per hour prices in AWS Fargate
-// http://aws.amazon.com/fargate/pricing/ and GPU instance prices.
-// var (
-// cpuWeight    = 9
-// memoryWeight = 1
-//
-//	gpuWeights   = map[string]int{
-//		"g4ad": 43,  // AMD Radeon Pro V520
-//		"p4d":  625, // NVIDIA A100
-//		"p4de": 625, // NVIDIA A100
-//		"g5":   200, // NVIDIA A10G
-//		"g2":   57,  // NVIDIA K520
-//		"g4dn": 63,  // NVIDIA T4
-//		"g5g":  70,  // NVIDIA T4G
-//		"p2":   140, // NVIDIA K80
-//		"g3":   120, // NVIDIA M60
-//		"g3s":  120, // NVIDIA M60
-//		"p3":   632, // NVIDIA V100
-//		"p3dn": 632, // NVIDIA V100
-//	}
-// )
-
 type Allocation struct {
 	// CPU fraction of total CPU
 	CPU float64 `json:"cpu"`
@@ -52,6 +60,8 @@ type Allocation struct {
 	Storage float64 `json:"storage,omitempty"`
 	// ephemeral storage fraction of total ephemeral storage
 	StorageEphemeral float64 `json:"storage_ephemeral,omitempty"`
+	// extended resources fraction of total extended resources by resource name
+	Extended map[string]float64 `json:"extended,omitempty"`
 }
 
 type Allocations struct {
@@ -65,11 +75,17 @@ type Ask struct {
 	Storage          int64 `json:"storage,omitempty"`
 	StorageEphemeral int64 `json:"storage_ephemeral,omitempty"`
 	GPU              int64 `json:"gpu,omitempty"`
+	// Extended resources by resource name, e.g. aws.amazon.com/neuron
+	Extended map[string]int64 `json:"extended,omitempty"`
 }
 
 type Resources struct {
 	Requests Ask `json:"requests,omitempty"`
 	Limits   Ask `json:"limits,omitempty"`
+	// Allocated resources the pod cost is allocated by, see AllocationModel
+	Allocated Ask `json:"allocated,omitempty"`
+	// Overhead of the pod RuntimeClass (e.g. Kata), included in requests and set limits
+	Overhead Ask `json:"overhead,omitempty"`
 }
 
 type Capacity struct {
@@ -85,20 +101,50 @@ type Capacity struct {
 	Storage int64 `json:"storage,omitempty"`
 	// ephemeral storage in Kibibytes
 	StorageEphemeral int64 `json:"storage_ephemeral,omitempty"`
+	// Extended resources advertised by the node, by resource name
+	Extended map[string]int64 `json:"extended,omitempty"`
 }
 
 // Cost is the cost of an instance per hour per resource
 type Cost struct {
-	// Hourly cost of instance (on-demand, spot, or reserved)
+	// Hourly cost of instance (on-demand, spot, or reserved): amortized effective price after commitments
 	InstanceHour float64 `json:"instance_hour"`
+	// Hourly list price of instance before price overrides and commitments
+	ListHour float64 `json:"list_hour"`
+	// Hourly price of instance after price overrides and before commitments
+	OverrideHour float64 `json:"override_hour"`
 	// Unit-cost-per-resource = Hourly-instance-cost/((Memory-weight * Memory-available) + (CPU-weight * CPU-available) + (GPU-weight * GPU-available))
 	UnitCostResource float64 `json:"unit_cost_resource"`
 	// Cost-per-vCPU-hour = CPU-weight * Unit-cost-per-resource
 	VCPUHour float64 `json:"vcpu_hour"`
-	// Cost-per-memory-hour = Memory-weight * Unit-cost-per-resource
+	// Cost-per-GiB-memory-hour = Memory-weight * Unit-cost-per-resource
 	MemoryHour float64 `json:"memory_hour"`
 	// Cost-per-GPU-hour = GPU-weight * Unit-cost-per-resource
 	GPUHour float64 `json:"gpu_hour"`
+	// Cost-per-unit-hour of extended resources by resource name: Extended-weight * Unit-cost-per-resource or fixed price
+	ExtendedHour map[string]float64 `json:"extended_hour,omitempty"`
+	// PriceRule is the price override rule that produced the instance hourly cost, empty without overrides
+	PriceRule string `json:"price_rule,omitempty"`
+	// Commitments (Reserved Instances, Savings Plans) covering the instance, comma separated
+	Commitment string `json:"commitment,omitempty"`
+}
+
+// PodCost is the cost of a pod in USD for its reporting interval
+type PodCost struct {
+	CPU    float64 `json:"cpu"`
+	Memory float64 `json:"memory"`
+	GPU    float64 `json:"gpu"`
+	// Extended is the extended resources cost
+	Extended float64 `json:"extended,omitempty"`
+	// NodeOverhead is the pod share of the node system-reserved overhead cost (proportional overhead policy)
+	NodeOverhead float64 `json:"node_overhead,omitempty"`
+	// ClusterFee is the EKS control plane fee or the namespace share of it
+	ClusterFee float64 `json:"cluster_fee,omitempty"`
+	// Storage is the persistent volume cost
+	Storage float64 `json:"storage,omitempty"`
+	// LoadBalancer is the LoadBalancer Service cost
+	LoadBalancer float64 `json:"load_balancer,omitempty"`
+	Total        float64 `json:"total"`
 }
 
 type NodeInfo struct {
@@ -123,11 +169,20 @@ type NodeInfo struct {
 	Capacity       Capacity  `json:"capacity"`
 	Created        time.Time `json:"created"`
 	Cost           Cost      `json:"cost"`
+	// Labels and Annotations of the node selected by the metadata policy
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 type PodInfo struct {
-	Name        string            `json:"name"`
-	Namespace   string            `json:"namespace"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// PodUID is the UID of the pod of pod records, telling apart pods recreated under the same name
+	PodUID string `json:"pod_uid,omitempty"`
+	// RecordID is the deterministic record identity for removing duplicates, see SetRecordID
+	RecordID string `json:"record_id"`
+	// RecordType: pod or idle
+	RecordType  string            `json:"record_type"`
 	Labels      map[string]string `json:"labels,omitempty"`
 	Node        NodeInfo          `json:"node"`
 	QosClass    string            `json:"qos_class"`
@@ -136,9 +191,31 @@ type PodInfo struct {
 	EndTime     time.Time         `json:"end_time"`
 	Resources   Resources         `json:"resources,omitempty"`
 	Allocations Allocations       `json:"allocations,omitempty"`
+	// AllocationModel that produced the pod cost: requests, usage, max or blend
+	AllocationModel string  `json:"allocation_model,omitempty"`
+	Cost            PodCost `json:"cost"`
+	// Annotations of the pod selected by the metadata policy
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// NamespaceLabels and NamespaceAnnotations are the configured labels and annotations of the pod namespace
+	NamespaceLabels      map[string]string `json:"namespace_labels,omitempty"`
+	NamespaceAnnotations map[string]string `json:"namespace_annotations,omitempty"`
+	// OwnerKind and OwnerName are the pod controller owner, e.g. ReplicaSet or Job
+	OwnerKind string `json:"owner_kind,omitempty"`
+	OwnerName string `json:"owner_name,omitempty"`
+	// TopOwnerKind and TopOwnerName are the workload at the top of the ownership chain, e.g. Deployment or CronJob
+	TopOwnerKind string `json:"top_owner_kind,omitempty"`
+	TopOwnerName string `json:"top_owner_name,omitempty"`
+	// Usage is the actual pod resources usage, empty when usage collection is disabled
+	Usage *ResourceUsage `json:"usage,omitempty"`
+	// Containers of pod records: requests, limits and status by container
+	Containers []ContainerInfo `json:"containers,omitempty"`
+	// Volume is the persistent volume of volume records
+	Volume *VolumeInfo `json:"volume,omitempty"`
+	// LoadBalancer is the load balancer of LoadBalancer Service records
+	LoadBalancer *LoadBalancerInfo `json:"load_balancer,omitempty"`
 }
 
-func NodeInfoFromNode(cluster string, node *v1.Node) NodeInfo {
+func NodeInfoFromNode(cluster string, node *v1.Node, policy *MetadataPolicy) NodeInfo {
 	// get compute type from node label, default to ec2
 	computeType := node.GetLabels()["eks.amazonaws.com/compute-type"]
 	if computeType == "" {
@@ -147,7 +224,7 @@ func NodeInfoFromNode(cluster string, node *v1.Node) NodeInfo {
 	// get capacity type from node label, default to on-demand
 	capacityType := node.GetLabels()["eks.amazonaws.com/capacityType"]
 	if capacityType == "" {
-		capacityType = "ON_DEMAND"
+		capacityType = CapacityTypeOnDemand
 	}
 	// get instance ID from node provider ID
 	// EC2: aws:///us-west-2a/i-0f9f9f9f9f9f9f9f9
@@ -203,51 +280,49 @@ func NodeInfoFromNode(cluster string, node *v1.Node) NodeInfo {
 		KubeletVersion: node.Status.NodeInfo.KubeletVersion,
 		Runtime:        node.Status.NodeInfo.ContainerRuntimeVersion,
 		Allocatable: Capacity{
-			GPU:              node.Status.Allocatable.Name("nvidia.com/gpu", resource.DecimalSI).Value(),
+			GPU:              node.Status.Allocatable.Name(ResourceGPU, resource.DecimalSI).Value(),
 			CPU:              node.Status.Allocatable.Cpu().MilliValue(),
 			Memory:           node.Status.Allocatable.Memory().Value(),
 			Pods:             node.Status.Allocatable.Pods().Value(),
 			Storage:          node.Status.Allocatable.Storage().Value(),
 			StorageEphemeral: node.Status.Allocatable.StorageEphemeral().Value(),
+			Extended:         getExtended(node.Status.Allocatable),
 		},
 		Capacity: Capacity{
-			GPU:              node.Status.Capacity.Name("nvidia.com/gpu", resource.DecimalSI).Value(),
+			GPU:              node.Status.Capacity.Name(ResourceGPU, resource.DecimalSI).Value(),
 			CPU:              node.Status.Capacity.Cpu().MilliValue(),
 			Memory:           node.Status.Capacity.Memory().Value(),
 			Pods:             node.Status.Capacity.Pods().Value(),
 			Storage:          node.Status.Capacity.Storage().Value(),
 			StorageEphemeral: node.Status.Capacity.StorageEphemeral().Value(),
+			Extended:         getExtended(node.Status.Capacity),
 		},
 		Created: node.GetCreationTimestamp().Time,
 	}
+	if policy != nil {
+		result.Labels = policy.Capture(&policy.Nodes.Labels, node.GetLabels())
+		result.Annotations = policy.Capture(&policy.Nodes.Annotations, node.GetAnnotations())
+	}
 	return result
 }
 
-func GetPodInfo(log *logrus.Entry, pod *v1.Pod, beginTime, endTime time.Time, node *NodeInfo) *PodInfo {
+func GetPodInfo(log *logrus.Entry, pod *v1.Pod, beginTime, endTime time.Time, node *NodeInfo, policy *MetadataPolicy) *PodInfo {
 	record := &PodInfo{}
 	record.Name = pod.GetName()
 	record.Namespace = pod.GetNamespace()
-	// calculate pod's requested CPU and memory for all containers
-	for _, container := range pod.Spec.Containers {
-		record.Resources.Requests.CPU += container.Resources.Requests.Cpu().MilliValue()
-		record.Resources.Requests.Memory += container.Resources.Requests.Memory().Value()
-		record.Resources.Requests.GPU += container.Resources.Requests.Name("nvidia.com/gpu", resource.DecimalSI).Value()
-		record.Resources.Requests.Storage += container.Resources.Requests.Storage().Value()
-		record.Resources.Requests.StorageEphemeral += container.Resources.Requests.StorageEphemeral().Value()
-
-		record.Resources.Limits.CPU += container.Resources.Limits.Cpu().MilliValue()
-		record.Resources.Limits.Memory += container.Resources.Limits.Memory().Value()
-		record.Resources.Limits.GPU += container.Resources.Limits.Name("nvidia.com/gpu", resource.DecimalSI).Value()
-		record.Resources.Limits.Storage += container.Resources.Limits.Storage().Value()
-		record.Resources.Limits.StorageEphemeral += container.Resources.Limits.StorageEphemeral().Value()
-	}
-	// copy pod labels, skip ending with "-hash"
-	record.Labels = make(map[string]string)
-	for k, v := range pod.GetLabels() {
-		if !strings.HasSuffix(k, "-hash") {
-			record.Labels[k] = v
-		}
+	record.PodUID = string(pod.GetUID())
+	record.RecordType = RecordTypePod
+	// calculate pod's effective requests and limits of all containers and pod overhead
+	record.Resources = GetPodResources(pod)
+	record.Containers = GetContainersInfo(pod)
+	record.Resources.Allocated = record.Resources.Requests
+	record.AllocationModel = AllocationModelRequests
+	// copy pod labels and annotations selected by the metadata policy
+	if policy == nil {
+		policy = defaultMetadataPolicy
 	}
+	record.Labels = policy.Capture(&policy.Pods.Labels, pod.GetLabels())
+	record.Annotations = policy.Capture(&policy.Pods.Annotations, pod.GetAnnotations())
 	// copy pod QoS class
 	record.QosClass = string(pod.Status.QOSClass)
 	// set pod measured time
@@ -263,37 +338,293 @@ func GetPodInfo(log *logrus.Entry, pod *v1.Pod, beginTime, endTime time.Time, no
 	}
 	if node != nil {
 		// patch fargate node info from pod annotations, if needed
-		err := patchFargateNodeInfo(pod, node)
+		err := PatchFargateNodeInfo(pod, node)
 		if err != nil {
 			log.WithError(err).WithField("node", node.Name).Warn("failed to patch fargate node info")
 		}
 		record.Node = *node
 		// calculate pod's allocation requests as a percentage of node's allocatable resources
-		if node.Allocatable.CPU > 0 {
-			record.Allocations.Requests.CPU = float64(record.Resources.Requests.CPU) / float64(node.Allocatable.CPU)
-			record.Allocations.Limits.CPU = float64(record.Resources.Limits.CPU) / float64(node.Allocatable.CPU)
+		record.Allocations = GetAllocations(record.Resources, node.Allocatable)
+		record.Cost = GetPodCost(record.Resources.Requests, node.Cost, record.BeginTime, record.EndTime)
+	}
+	return record
+}
+
+// GetPodEndTime returns the time the pod stopped running: the latest container finish time when all the
+// pod containers are terminated, otherwise the pod deletion request time; never after now
+func GetPodEndTime(pod *v1.Pod, now time.Time) time.Time {
+	var finished time.Time
+	for i := range pod.Status.ContainerStatuses {
+		terminated := pod.Status.ContainerStatuses[i].State.Terminated
+		if terminated == nil || terminated.FinishedAt.IsZero() {
+			finished = time.Time{}
+			break
 		}
-		if node.Allocatable.Memory > 0 {
-			record.Allocations.Requests.Memory = float64(record.Resources.Requests.Memory) / float64(node.Allocatable.Memory)
-			record.Allocations.Limits.Memory = float64(record.Resources.Limits.Memory) / float64(node.Allocatable.Memory)
+		if terminated.FinishedAt.After(finished) {
+			finished = terminated.FinishedAt.Time
 		}
-		if node.Allocatable.GPU > 0 {
-			record.Allocations.Requests.GPU = float64(record.Resources.Requests.GPU) / float64(node.Allocatable.GPU)
-			record.Allocations.Limits.GPU = float64(record.Resources.Limits.GPU) / float64(node.Allocatable.GPU)
+	}
+	// deletion timestamp is the deletion request time plus the grace period
+	if finished.IsZero() && pod.DeletionTimestamp != nil {
+		finished = pod.DeletionTimestamp.Time
+		if pod.DeletionGracePeriodSeconds != nil {
+			finished = finished.Add(-time.Duration(*pod.DeletionGracePeriodSeconds) * time.Second)
 		}
-		if node.Allocatable.Storage > 0 {
-			record.Allocations.Requests.Storage = float64(record.Resources.Requests.Storage) / float64(node.Allocatable.Storage)
-			record.Allocations.Limits.Storage = float64(record.Resources.Limits.Storage) / float64(node.Allocatable.Storage)
+	}
+	if finished.IsZero() || finished.After(now) {
+		return now
+	}
+	return finished
+}
+
+// SetRecordID sets the record ID to the hash of the cluster, the record object and the record interval; the object
+// is the pod UID of pod records and the record type, namespace, name and node of other records
+func (p *PodInfo) SetRecordID(cluster string) {
+	object := p.PodUID
+	if object == "" {
+		object = strings.Join([]string{p.RecordType, p.Namespace, p.Name, p.Node.Name}, "/")
+	}
+	hash := sha256.Sum256([]byte(strings.Join([]string{
+		cluster,
+		object,
+		p.BeginTime.UTC().Format(time.RFC3339Nano),
+		p.EndTime.UTC().Format(time.RFC3339Nano),
+	}, "|")))
+	p.RecordID = hex.EncodeToString(hash[:])
+}
+
+// GetAllocations calculates requests and limits as a fraction of the node allocatable resources
+func GetAllocations(resources Resources, allocatable Capacity) Allocations {
+	var result Allocations
+	if allocatable.CPU > 0 {
+		result.Requests.CPU = float64(resources.Requests.CPU) / float64(allocatable.CPU)
+		result.Limits.CPU = float64(resources.Limits.CPU) / float64(allocatable.CPU)
+	}
+	if allocatable.Memory > 0 {
+		result.Requests.Memory = float64(resources.Requests.Memory) / float64(allocatable.Memory)
+		result.Limits.Memory = float64(resources.Limits.Memory) / float64(allocatable.Memory)
+	}
+	if allocatable.GPU > 0 {
+		result.Requests.GPU = float64(resources.Requests.GPU) / float64(allocatable.GPU)
+		result.Limits.GPU = float64(resources.Limits.GPU) / float64(allocatable.GPU)
+	}
+	if allocatable.Storage > 0 {
+		result.Requests.Storage = float64(resources.Requests.Storage) / float64(allocatable.Storage)
+		result.Limits.Storage = float64(resources.Limits.Storage) / float64(allocatable.Storage)
+	}
+	if allocatable.StorageEphemeral > 0 {
+		result.Requests.StorageEphemeral = float64(resources.Requests.StorageEphemeral) / float64(allocatable.StorageEphemeral)
+		result.Limits.StorageEphemeral = float64(resources.Limits.StorageEphemeral) / float64(allocatable.StorageEphemeral)
+	}
+	result.Requests.Extended = extendedAllocation(resources.Requests.Extended, allocatable.Extended)
+	result.Limits.Extended = extendedAllocation(resources.Limits.Extended, allocatable.Extended)
+	return result
+}
+
+// amounts are fractional resource amounts, e.g. resources averaged over an interval
+type amounts struct {
+	cpu, memory, gpu float64
+	extended         map[string]float64
+}
+
+func askAmounts(ask Ask) amounts {
+	result := amounts{cpu: float64(ask.CPU), memory: float64(ask.Memory), gpu: float64(ask.GPU)}
+	for name, value := range ask.Extended {
+		if result.extended == nil {
+			result.extended = make(map[string]float64)
+		}
+		result.extended[name] = float64(value)
+	}
+	return result
+}
+
+// averageAllocated returns the resources allocated to the records averaged over the beginTime-endTime interval:
+// each record counts for the part of the interval it overlaps
+func averageAllocated(records []*PodInfo, beginTime, endTime time.Time) amounts {
+	result := amounts{extended: make(map[string]float64)}
+	interval := endTime.Sub(beginTime)
+	if interval <= 0 {
+		return result
+	}
+	for _, record := range records {
+		begin, end := record.BeginTime, record.EndTime
+		if begin.Before(beginTime) {
+			begin = beginTime
 		}
-		if node.Allocatable.StorageEphemeral > 0 {
-			record.Allocations.Requests.StorageEphemeral = float64(record.Resources.Requests.StorageEphemeral) / float64(node.Allocatable.StorageEphemeral)
-			record.Allocations.Limits.StorageEphemeral = float64(record.Resources.Limits.StorageEphemeral) / float64(node.Allocatable.StorageEphemeral)
+		if end.After(endTime) {
+			end = endTime
+		}
+		if !end.After(begin) {
+			continue
+		}
+		share := float64(end.Sub(begin)) / float64(interval)
+		allocated := record.Resources.Allocated
+		result.cpu += float64(allocated.CPU) * share
+		result.memory += float64(allocated.Memory) * share
+		result.gpu += float64(allocated.GPU) * share
+		for name, value := range allocated.Extended {
+			result.extended[name] += float64(value) * share
 		}
 	}
+	return result
+}
+
+// GetNodeIdleInfo returns the synthetic idle record of the node for the beginTime-endTime interval: node allocatable
+// resources not allocated to the node pod records, each record counting for the part of the interval it overlaps,
+// so the node pods and idle records costs add up to the node cost
+func GetNodeIdleInfo(node *NodeInfo, pods []*PodInfo, beginTime, endTime time.Time) *PodInfo {
+	record := &PodInfo{
+		Name:       IdleName,
+		Namespace:  IdleNamespace,
+		RecordType: RecordTypeIdle,
+		Node:       *node,
+		StartTime:  node.Created,
+		BeginTime:  beginTime,
+		EndTime:    endTime,
+	}
+	// node created during the interval
+	if node.Created.After(beginTime) {
+		record.BeginTime = node.Created
+	}
+	requested := averageAllocated(pods, record.BeginTime, endTime)
+	idle := amounts{
+		cpu:    unallocated(node.Allocatable.CPU, requested.cpu),
+		memory: unallocated(node.Allocatable.Memory, requested.memory),
+		gpu:    unallocated(node.Allocatable.GPU, requested.gpu),
+	}
+	for name, value := range node.Allocatable.Extended {
+		if amount := unallocated(value, requested.extended[name]); amount > 0 {
+			if idle.extended == nil {
+				idle.extended = make(map[string]float64)
+			}
+			idle.extended[name] = amount
+		}
+	}
+	record.Resources.Requests = Ask{
+		CPU:    int64(math.Round(idle.cpu)),
+		Memory: int64(math.Round(idle.memory)),
+		GPU:    int64(math.Round(idle.gpu)),
+	}
+	for name, value := range idle.extended {
+		record.Resources.Requests.setExtended(name, int64(math.Round(value)))
+	}
+	record.Allocations = GetAllocations(record.Resources, node.Allocatable)
+	// idle cost of the fractional idle resources
+	record.Cost = getCost(idle, node.Cost, record.BeginTime, record.EndTime)
+	return record
+}
+
+// GetOverheadInfo returns the synthetic overhead record of the node for the beginTime-endTime interval:
+// node capacity CPU, memory and GPU not allocatable to pods (kube-reserved, system-reserved, eviction thresholds)
+func GetOverheadInfo(node *NodeInfo, beginTime, endTime time.Time) *PodInfo {
+	record := &PodInfo{
+		Name:       OverheadName,
+		Namespace:  OverheadNamespace,
+		RecordType: RecordTypeOverhead,
+		Node:       *node,
+		StartTime:  node.Created,
+		BeginTime:  beginTime,
+		EndTime:    endTime,
+	}
+	// node created during the interval
+	if node.Created.After(beginTime) {
+		record.BeginTime = node.Created
+	}
+	record.Resources.Requests = GetNodeOverhead(node)
+	record.Allocations = GetAllocations(record.Resources, node.Capacity)
+	record.Cost = GetPodCost(record.Resources.Requests, node.Cost, record.BeginTime, record.EndTime)
+	return record
+}
+
+// GetClusterFeeInfo returns the synthetic EKS control plane fee record for the beginTime-endTime interval;
+// namespace is empty for the whole cluster fee, otherwise the record is the namespace share of the fee
+func GetClusterFeeInfo(cluster, namespace string, hourlyFee, share float64, beginTime, endTime time.Time) *PodInfo {
+	record := &PodInfo{
+		Name:       ClusterFeeName,
+		Namespace:  namespace,
+		RecordType: RecordTypeClusterFee,
+		Node:       NodeInfo{Cluster: cluster},
+		BeginTime:  beginTime,
+		EndTime:    endTime,
+	}
+	if namespace == "" {
+		record.Namespace = ClusterFeeNamespace
+	}
+	if hours := endTime.Sub(beginTime).Hours(); hours > 0 {
+		record.Cost.ClusterFee = hourlyFee * share * hours
+		record.Cost.Total = record.Cost.ClusterFee
+	}
 	return record
 }
 
-func patchFargateNodeInfo(pod *v1.Pod, node *NodeInfo) error {
+// GetNodeOverhead returns node capacity CPU, memory, GPU and extended resources not allocatable to pods
+func GetNodeOverhead(node *NodeInfo) Ask {
+	return Ask{
+		CPU:      unrequested(node.Capacity.CPU, node.Allocatable.CPU),
+		Memory:   unrequested(node.Capacity.Memory, node.Allocatable.Memory),
+		GPU:      unrequested(node.Capacity.GPU, node.Allocatable.GPU),
+		Extended: unrequestedExtended(node.Capacity.Extended, node.Allocatable.Extended),
+	}
+}
+
+// SpreadOverhead adds the node overhead cost to the pod records proportionally to the pod costs;
+// it returns false when the pods have no cost to spread the overhead by
+func SpreadOverhead(overhead float64, records []*PodInfo) bool {
+	var total float64
+	for _, record := range records {
+		total += record.Cost.Total
+	}
+	if total <= 0 {
+		return false
+	}
+	for _, record := range records {
+		share := overhead * record.Cost.Total / total
+		record.Cost.NodeOverhead += share
+		record.Cost.Total += share
+	}
+	return true
+}
+
+// unallocated returns allocatable resource not allocated to pods; overcommitted resource has no idle capacity
+func unallocated(allocatable int64, allocated float64) float64 {
+	if allocated >= float64(allocatable) {
+		return 0
+	}
+	return float64(allocatable) - allocated
+}
+
+// unrequested returns allocatable resource not requested by pods; overcommitted resource has no idle capacity
+func unrequested(allocatable, requested int64) int64 {
+	if requested >= allocatable {
+		return 0
+	}
+	return allocatable - requested
+}
+
+// GetPodCost calculates the cost of requested resources for the beginTime-endTime interval from the node hourly costs
+func GetPodCost(requests Ask, cost Cost, beginTime, endTime time.Time) PodCost {
+	return getCost(askAmounts(requests), cost, beginTime, endTime)
+}
+
+func getCost(resources amounts, cost Cost, beginTime, endTime time.Time) PodCost {
+	hours := endTime.Sub(beginTime).Hours()
+	if hours <= 0 {
+		return PodCost{}
+	}
+	result := PodCost{
+		CPU:    resources.cpu / millicores * cost.VCPUHour * hours,
+		Memory: resources.memory / gibibyte * cost.MemoryHour * hours,
+		GPU:    resources.gpu * cost.GPUHour * hours,
+	}
+	for name, value := range resources.extended {
+		result.Extended += value * cost.ExtendedHour[name] * hours
+	}
+	result.Total = result.CPU + result.Memory + result.GPU + result.Extended
+	return result
+}
+
+// PatchFargateNodeInfo patches Fargate node capacity, allocatable resources, instance type and profile from the pod
+func PatchFargateNodeInfo(pod *v1.Pod, node *NodeInfo) error {
 	if node.ComputeType != fargateType {
 		return nil
 	}
@@ -304,6 +635,9 @@ func patchFargateNodeInfo(pod *v1.Pod, node *NodeInfo) error {
 		if err != nil {
 			return errors.Wrap(err, "failed to parse capacity provisioned")
 		}
+		// provisioned capacity is billed
+		node.Capacity.CPU = cpu
+		node.Capacity.Memory = memory
 		node.Allocatable.CPU = cpu
 		// 256MB is reserved for Kubernetes components on Fargate, so we need to subtract it from allocatable memory
 		node.Allocatable.Memory = memory - 256*int64(math.Pow10(6)) //nolint:gomnd
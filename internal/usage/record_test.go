@@ -116,11 +116,19 @@ func TestGetPodInfo(t *testing.T) {
 						StorageEphemeral: 4 * (1 << 30),   // 4Gi
 					},
 					Limits: Ask{
-						CPU:              1200,             // 1200m
-						Memory:           1536 * (1 << 20), // 1536Mi
-						Storage:          200 * (1 << 30),  // 200Gi
-						GPU:              1,                // 1 GPU
-						StorageEphemeral: 8 * (1 << 30),    // 8Gi
+						CPU:     1200,             // 1200m
+						Memory:  1536 * (1 << 20), // 1536Mi
+						Storage: 200 * (1 << 30),  // 200Gi
+						GPU:     1,                // 1 GPU
+						// ephemeral storage limit is not set by every container
+					},
+					// allocated by requests
+					Allocated: Ask{
+						CPU:              300,
+						Memory:           768 * (1 << 20),
+						Storage:          100 * (1 << 30),
+						GPU:              1,
+						StorageEphemeral: 4 * (1 << 30),
 					},
 				},
 				Allocations: Allocations{
@@ -132,11 +140,10 @@ func TestGetPodInfo(t *testing.T) {
 						StorageEphemeral: float64(4) / 10,
 					},
 					Limits: Allocation{
-						CPU:              float64(1200) / 1000,
-						Memory:           float64(1536) / (2 * (1 << 10)),
-						GPU:              1,
-						Storage:          float64(200) / 300,
-						StorageEphemeral: float64(8) / 10,
+						CPU:     float64(1200) / 1000,
+						Memory:  float64(1536) / (2 * (1 << 10)),
+						GPU:     1,
+						Storage: float64(200) / 300,
 					},
 				},
 				Node: NodeInfo{
@@ -154,7 +161,7 @@ func TestGetPodInfo(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := GetPodInfo(tt.args.log, tt.args.pod, tt.args.beginTime, tt.args.endTime, tt.args.node)
+			got := GetPodInfo(tt.args.log, tt.args.pod, tt.args.beginTime, tt.args.endTime, tt.args.node, nil)
 
 			if got.Name != tt.want.Name {
 				t.Errorf("GetPodInfo().LongName = %v, want %v", got.Name, tt.want.Name)
@@ -349,7 +356,7 @@ func TestPatchFargateNodeInfo(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		err := patchFargateNodeInfo(test.pod, test.node)
+		err := PatchFargateNodeInfo(test.pod, test.node)
 
 		if err != nil && test.expectedError == nil {
 			t.Errorf("Unexpected error. Pod: %+v, Node: %+v, Error: %v", test.pod, test.node, err)
@@ -365,3 +372,251 @@ func TestPatchFargateNodeInfo(t *testing.T) {
 		}
 	}
 }
+
+func TestGetPodCost(t *testing.T) {
+	const epsilon = 1e-9
+	beginTime := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		requests Ask
+		cost     Cost
+		endTime  time.Time
+		want     PodCost
+	}{
+		{
+			name: "half hour of CPU, memory and GPU",
+			requests: Ask{
+				CPU:    500,           // 0.5 vCPU
+				Memory: 2 * (1 << 30), // 2Gi
+				GPU:    1,
+			},
+			cost: Cost{
+				VCPUHour:   0.036,
+				MemoryHour: 0.004,
+				GPUHour:    0.8,
+			},
+			endTime: beginTime.Add(30 * time.Minute),
+			want: PodCost{
+				CPU:    0.5 * 0.036 * 0.5,
+				Memory: 2 * 0.004 * 0.5,
+				GPU:    0.8 * 0.5,
+				Total:  0.5*0.036*0.5 + 2*0.004*0.5 + 0.8*0.5,
+			},
+		},
+		{
+			name:     "empty interval",
+			requests: Ask{CPU: 1000, Memory: 1 << 30},
+			cost:     Cost{VCPUHour: 0.036, MemoryHour: 0.004},
+			endTime:  beginTime,
+			want:     PodCost{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GetPodCost(tt.requests, tt.cost, beginTime, tt.endTime)
+			if math.Abs(got.CPU-tt.want.CPU) > epsilon ||
+				math.Abs(got.Memory-tt.want.Memory) > epsilon ||
+				math.Abs(got.GPU-tt.want.GPU) > epsilon ||
+				math.Abs(got.Total-tt.want.Total) > epsilon {
+				t.Errorf("GetPodCost() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetNodeIdleInfo(t *testing.T) {
+	const epsilon = 1e-9
+	beginTime := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	endTime := beginTime.Add(time.Hour)
+	node := &NodeInfo{
+		Name:        "test-node",
+		Allocatable: Capacity{CPU: 2000, Memory: 8 * (1 << 30), GPU: 1},
+		Cost:        Cost{VCPUHour: 0.04, MemoryHour: 0.005, GPUHour: 0.9},
+	}
+	pod := func(allocated Ask, begin time.Time) *PodInfo {
+		record := &PodInfo{RecordType: RecordTypePod, BeginTime: begin, EndTime: endTime}
+		record.Resources.Allocated = allocated
+		return record
+	}
+	tests := []struct {
+		name      string
+		created   time.Time
+		pods      []*PodInfo
+		wantIdle  Ask
+		wantBegin time.Time
+	}{
+		{
+			name:      "partially allocated node",
+			pods:      []*PodInfo{pod(Ask{CPU: 500, Memory: 2 * (1 << 30), StorageEphemeral: 1 << 30}, beginTime)},
+			wantIdle:  Ask{CPU: 1500, Memory: 6 * (1 << 30), GPU: 1},
+			wantBegin: beginTime,
+		},
+		{
+			name:      "pod record overlapping half of the interval",
+			pods:      []*PodInfo{pod(Ask{CPU: 1000, Memory: 4 * (1 << 30)}, beginTime.Add(30*time.Minute))},
+			wantIdle:  Ask{CPU: 1500, Memory: 6 * (1 << 30), GPU: 1},
+			wantBegin: beginTime,
+		},
+		{
+			name:      "overcommitted node",
+			pods:      []*PodInfo{pod(Ask{CPU: 3000, Memory: 8 * (1 << 30), GPU: 1}, beginTime)},
+			wantIdle:  Ask{},
+			wantBegin: beginTime,
+		},
+		{
+			name:      "node created during interval",
+			created:   beginTime.Add(30 * time.Minute),
+			wantIdle:  Ask{CPU: 2000, Memory: 8 * (1 << 30), GPU: 1},
+			wantBegin: beginTime.Add(30 * time.Minute),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node.Created = tt.created
+			got := GetNodeIdleInfo(node, tt.pods, beginTime, endTime)
+			if got.Name != IdleName || got.Namespace != IdleNamespace || got.RecordType != RecordTypeIdle {
+				t.Errorf("GetNodeIdleInfo() = %s/%s %s, want idle record", got.Namespace, got.Name, got.RecordType)
+			}
+			if !reflect.DeepEqual(got.Resources.Requests, tt.wantIdle) {
+				t.Errorf("GetNodeIdleInfo().Resources.Requests = %+v, want %+v", got.Resources.Requests, tt.wantIdle)
+			}
+			if !got.BeginTime.Equal(tt.wantBegin) {
+				t.Errorf("GetNodeIdleInfo().BeginTime = %v, want %v", got.BeginTime, tt.wantBegin)
+			}
+			want := GetPodCost(tt.wantIdle, node.Cost, tt.wantBegin, endTime)
+			if math.Abs(got.Cost.Total-want.Total) > epsilon {
+				t.Errorf("GetNodeIdleInfo().Cost = %+v, want %+v", got.Cost, want)
+			}
+		})
+	}
+}
+
+func TestGetOverheadInfo(t *testing.T) {
+	beginTime := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	node := &NodeInfo{
+		Name:        "test-node",
+		Capacity:    Capacity{CPU: 2000, Memory: 8 * (1 << 30)},
+		Allocatable: Capacity{CPU: 1930, Memory: 7 * (1 << 30)},
+		Cost:        Cost{VCPUHour: 0.04, MemoryHour: 0.005},
+	}
+	got := GetOverheadInfo(node, beginTime, beginTime.Add(time.Hour))
+	if got.Name != OverheadName || got.Namespace != OverheadNamespace || got.RecordType != RecordTypeOverhead {
+		t.Errorf("GetOverheadInfo() = %s/%s %s, want overhead record", got.Namespace, got.Name, got.RecordType)
+	}
+	if want := (Ask{CPU: 70, Memory: 1 << 30}); !reflect.DeepEqual(got.Resources.Requests, want) {
+		t.Errorf("GetOverheadInfo().Resources.Requests = %+v, want %+v", got.Resources.Requests, want)
+	}
+	if want := 0.07*0.04 + 0.005; math.Abs(got.Cost.Total-want) > 1e-9 {
+		t.Errorf("GetOverheadInfo().Cost.Total = %v, want %v", got.Cost.Total, want)
+	}
+}
+
+func TestSpreadOverhead(t *testing.T) {
+	records := []*PodInfo{
+		{Cost: PodCost{CPU: 0.3, Total: 0.3}},
+		{Cost: PodCost{CPU: 0.1, Total: 0.1}},
+	}
+	if !SpreadOverhead(0.2, records) {
+		t.Fatal("SpreadOverhead() = false, want true")
+	}
+	if math.Abs(records[0].Cost.NodeOverhead-0.15) > 1e-9 || math.Abs(records[0].Cost.Total-0.45) > 1e-9 {
+		t.Errorf("SpreadOverhead() first pod cost = %+v", records[0].Cost)
+	}
+	if math.Abs(records[1].Cost.NodeOverhead-0.05) > 1e-9 {
+		t.Errorf("SpreadOverhead() second pod cost = %+v", records[1].Cost)
+	}
+	// no pods cost to spread the overhead by
+	if SpreadOverhead(0.2, []*PodInfo{{}}) {
+		t.Error("SpreadOverhead() = true for pods without cost")
+	}
+}
+
+func TestSetRecordID(t *testing.T) {
+	beginTime := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	newRecord := func(uid string, begin time.Time) *PodInfo {
+		record := &PodInfo{Name: "web-0", Namespace: "default", PodUID: uid, RecordType: RecordTypePod, BeginTime: begin, EndTime: begin.Add(15 * time.Minute)}
+		record.SetRecordID("test-cluster")
+		return record
+	}
+	got := newRecord("uid-1", beginTime)
+	if len(got.RecordID) != 64 {
+		t.Errorf("SetRecordID() = %q, want sha256 hex", got.RecordID)
+	}
+	// retried record keeps the ID, also in other time zone
+	if retry := newRecord("uid-1", beginTime.In(time.FixedZone("UTC+2", 2*60*60))); retry.RecordID != got.RecordID {
+		t.Errorf("SetRecordID() = %q for the same record, want %q", retry.RecordID, got.RecordID)
+	}
+	// pod recreated under the same name and the next interval get new IDs
+	if recreated := newRecord("uid-2", beginTime); recreated.RecordID == got.RecordID {
+		t.Error("SetRecordID() is the same for the recreated pod")
+	}
+	if next := newRecord("uid-1", beginTime.Add(15*time.Minute)); next.RecordID == got.RecordID {
+		t.Error("SetRecordID() is the same for the next interval")
+	}
+	// records without pod are identified by type, namespace, name and node
+	idle := &PodInfo{Name: IdleName, Namespace: IdleNamespace, RecordType: RecordTypeIdle, Node: NodeInfo{Name: "node-1"}, BeginTime: beginTime}
+	idle.SetRecordID("test-cluster")
+	other := *idle
+	other.Node.Name = "node-2"
+	other.SetRecordID("test-cluster")
+	if idle.RecordID == "" || idle.RecordID == other.RecordID {
+		t.Errorf("SetRecordID() = %q and %q for idle records of different nodes", idle.RecordID, other.RecordID)
+	}
+}
+
+func TestGetPodEndTime(t *testing.T) {
+	now := time.Date(2020, 1, 2, 1, 0, 0, 0, time.UTC)
+	terminated := func(finished time.Time) v1.ContainerStatus {
+		return v1.ContainerStatus{State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{FinishedAt: metav1.NewTime(finished)}}}
+	}
+	running := v1.ContainerStatus{State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}}
+	grace := int64(30)
+	deletion := metav1.NewTime(now.Add(-5 * time.Minute))
+	tests := []struct {
+		name string
+		pod  *v1.Pod
+		want time.Time
+	}{
+		{
+			name: "no status",
+			pod:  &v1.Pod{},
+			want: now,
+		},
+		{
+			name: "latest container finish time",
+			pod: &v1.Pod{Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				terminated(now.Add(-20 * time.Minute)),
+				terminated(now.Add(-10 * time.Minute)),
+			}}},
+			want: now.Add(-10 * time.Minute),
+		},
+		{
+			name: "container still running, deletion request time",
+			pod: &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &deletion, DeletionGracePeriodSeconds: &grace},
+				Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+					terminated(now.Add(-20 * time.Minute)),
+					running,
+				}},
+			},
+			want: now.Add(-5*time.Minute - 30*time.Second),
+		},
+		{
+			name: "container still running without deletion timestamp",
+			pod:  &v1.Pod{Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{running}}},
+			want: now,
+		},
+		{
+			name: "finish time in the future",
+			pod:  &v1.Pod{Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{terminated(now.Add(time.Minute))}}},
+			want: now,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetPodEndTime(tt.pod, now); !got.Equal(tt.want) {
+				t.Errorf("GetPodEndTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package usage
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// ContainerTypeApp is the type of app containers
+	ContainerTypeApp = "app"
+	// ContainerTypeInit is the type of init containers
+	ContainerTypeInit = "init"
+	// ContainerTypeSidecar is the type of restartable init containers
+	ContainerTypeSidecar = "sidecar"
+)
+
+// ContainerInfo is the pod container requests, limits and status
+type ContainerInfo struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+	// Type: app, init or sidecar
+	Type     string `json:"type"`
+	Requests Ask    `json:"requests"`
+	Limits   Ask    `json:"limits"`
+	// RestartCount of the container
+	RestartCount int32 `json:"restart_count"`
+	// LastTerminationReason of the previous container run, e.g. OOMKilled or Error
+	LastTerminationReason string `json:"last_termination_reason,omitempty"`
+}
+
+// GetContainersInfo returns the pod init, sidecar and app containers info
+func GetContainersInfo(pod *v1.Pod) []ContainerInfo {
+	result := make([]ContainerInfo, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	for i := range pod.Spec.InitContainers {
+		containerType := ContainerTypeInit
+		if isSidecar(&pod.Spec.InitContainers[i]) {
+			containerType = ContainerTypeSidecar
+		}
+		result = append(result, getContainerInfo(&pod.Spec.InitContainers[i], containerType, pod.Status.InitContainerStatuses))
+	}
+	for i := range pod.Spec.Containers {
+		result = append(result, getContainerInfo(&pod.Spec.Containers[i], ContainerTypeApp, pod.Status.ContainerStatuses))
+	}
+	return result
+}
+
+func getContainerInfo(container *v1.Container, containerType string, statuses []v1.ContainerStatus) ContainerInfo {
+	resources := getContainerResources(container)
+	info := ContainerInfo{
+		Name:     container.Name,
+		Image:    container.Image,
+		Type:     containerType,
+		Requests: resources.Requests,
+		Limits:   resources.Limits,
+	}
+	for i := range statuses {
+		if statuses[i].Name != container.Name {
+			continue
+		}
+		info.RestartCount = statuses[i].RestartCount
+		if terminated := statuses[i].LastTerminationState.Terminated; terminated != nil {
+			info.LastTerminationReason = terminated.Reason
+		}
+		break
+	}
+	return info
+}
+
+// GetPodResources returns the pod effective requests and limits the way the scheduler computes them:
+// the greater of app containers sum and the largest init container, sidecar (restartable) init containers
+// running along with the app containers, plus the pod overhead of its RuntimeClass; a resource limit is unset
+// unless every container sets it, the pod is not bounded by the other containers limits
+func GetPodResources(pod *v1.Pod) Resources {
+	var result Resources
+	// resources not limited by some container
+	var unlimited Ask
+	for i := range pod.Spec.Containers {
+		container := getContainerResources(&pod.Spec.Containers[i])
+		unlimited = unlimited.Add(unsetLimits(container.Limits))
+		result.Requests = result.Requests.Add(container.Requests)
+		result.Limits = result.Limits.Add(container.Limits)
+	}
+	// init containers run one by one, each one along with the sidecars started before it
+	var sidecars, init Resources
+	for i := range pod.Spec.InitContainers {
+		container := getContainerResources(&pod.Spec.InitContainers[i])
+		unlimited = unlimited.Add(unsetLimits(container.Limits))
+		if isSidecar(&pod.Spec.InitContainers[i]) {
+			result.Requests = result.Requests.Add(container.Requests)
+			result.Limits = result.Limits.Add(container.Limits)
+			sidecars.Requests = sidecars.Requests.Add(container.Requests)
+			sidecars.Limits = sidecars.Limits.Add(container.Limits)
+			container = sidecars
+		} else {
+			container.Requests = container.Requests.Add(sidecars.Requests)
+			container.Limits = container.Limits.Add(sidecars.Limits)
+		}
+		init.Requests = init.Requests.max(container.Requests)
+		init.Limits = init.Limits.max(container.Limits)
+	}
+	result.Requests = result.Requests.max(init.Requests)
+	result.Limits = result.Limits.max(init.Limits).unset(unlimited)
+	// pod overhead is added to requests and to the set limits
+	if pod.Spec.Overhead != nil {
+		result.Overhead = getAsk(pod.Spec.Overhead)
+		result.Requests = result.Requests.Add(result.Overhead)
+		result.Limits = result.Limits.addSet(result.Overhead)
+	}
+	return result
+}
+
+func getContainerResources(container *v1.Container) Resources {
+	return Resources{
+		Requests: getAsk(container.Resources.Requests),
+		Limits:   getAsk(container.Resources.Limits),
+	}
+}
+
+func getAsk(resources v1.ResourceList) Ask {
+	return Ask{
+		CPU:              resources.Cpu().MilliValue(),
+		Memory:           resources.Memory().Value(),
+		GPU:              resources.Name(ResourceGPU, resource.DecimalSI).Value(),
+		Storage:          resources.Storage().Value(),
+		StorageEphemeral: resources.StorageEphemeral().Value(),
+		Extended:         getExtended(resources),
+	}
+}
+
+// unsetLimits marks the CPU, memory and ephemeral storage the container does not limit; GPU and extended resources
+// limits equal requests, a container without them does not use them
+func unsetLimits(limits Ask) Ask {
+	unset := func(value int64) int64 {
+		if value == 0 {
+			return 1
+		}
+		return 0
+	}
+	return Ask{CPU: unset(limits.CPU), Memory: unset(limits.Memory), StorageEphemeral: unset(limits.StorageEphemeral)}
+}
+
+// isSidecar returns true for restartable init containers running for the pod whole life
+func isSidecar(container *v1.Container) bool {
+	return container.RestartPolicy != nil && *container.RestartPolicy == v1.ContainerRestartPolicyAlways
+}
+
+// Add returns the sum of the resources
+func (a Ask) Add(b Ask) Ask {
+	return a.combine(b, func(x, y int64) int64 { return x + y })
+}
+
+// IsZero returns true if no resources are asked
+func (a Ask) IsZero() bool {
+	for _, value := range a.Extended {
+		if value != 0 {
+			return false
+		}
+	}
+	return a.CPU == 0 && a.Memory == 0 && a.Storage == 0 && a.StorageEphemeral == 0 && a.GPU == 0
+}
+
+// addSet adds b to the non-zero resources of a
+func (a Ask) addSet(b Ask) Ask {
+	return a.combine(b, func(x, y int64) int64 {
+		if x == 0 {
+			return 0
+		}
+		return x + y
+	})
+}
+
+// unset zeroes the resources of a marked in b
+func (a Ask) unset(b Ask) Ask {
+	return a.combine(b, func(x, y int64) int64 {
+		if y != 0 {
+			return 0
+		}
+		return x
+	})
+}
+
+func (a Ask) max(b Ask) Ask {
+	return a.combine(b, func(x, y int64) int64 {
+		if y > x {
+			return y
+		}
+		return x
+	})
+}
+
+// combine combines each resource of a and b, including the extended resources of either
+func (a Ask) combine(b Ask, f func(x, y int64) int64) Ask {
+	result := Ask{
+		CPU:              f(a.CPU, b.CPU),
+		Memory:           f(a.Memory, b.Memory),
+		Storage:          f(a.Storage, b.Storage),
+		StorageEphemeral: f(a.StorageEphemeral, b.StorageEphemeral),
+		GPU:              f(a.GPU, b.GPU),
+	}
+	for name := range a.Extended {
+		result.setExtended(name, f(a.Extended[name], b.Extended[name]))
+	}
+	for name := range b.Extended {
+		if _, ok := a.Extended[name]; !ok {
+			result.setExtended(name, f(0, b.Extended[name]))
+		}
+	}
+	return result
+}
+
+func (a *Ask) setExtended(name string, value int64) {
+	if value == 0 {
+		return
+	}
+	if a.Extended == nil {
+		a.Extended = make(map[string]int64)
+	}
+	a.Extended[name] = value
+}
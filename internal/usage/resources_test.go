@@ -0,0 +1,149 @@
+package usage
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestGetPodResources(t *testing.T) {
+	always := v1.ContainerRestartPolicyAlways
+	container := func(cpu, memory string) v1.Container {
+		return v1.Container{Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu), v1.ResourceMemory: resource.MustParse(memory)},
+			Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse(memory)},
+		}}
+	}
+	sidecar := func(cpu, memory string) v1.Container {
+		c := container(cpu, memory)
+		c.RestartPolicy = &always
+		return c
+	}
+	tests := []struct {
+		name string
+		spec v1.PodSpec
+		want Resources
+	}{
+		{
+			name: "app containers sum",
+			spec: v1.PodSpec{Containers: []v1.Container{container("100m", "64Mi"), container("200m", "128Mi")}},
+			want: Resources{
+				Requests: Ask{CPU: 300, Memory: 192 << 20},
+				Limits:   Ask{Memory: 192 << 20},
+			},
+		},
+		{
+			name: "largest init container",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{container("1", "32Mi"), container("500m", "1Gi")},
+				Containers:     []v1.Container{container("100m", "64Mi"), container("200m", "128Mi")},
+			},
+			want: Resources{
+				Requests: Ask{CPU: 1000, Memory: 1 << 30},
+				Limits:   Ask{Memory: 1 << 30},
+			},
+		},
+		{
+			name: "sidecar init container",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{sidecar("100m", "64Mi"), container("1", "32Mi")},
+				Containers:     []v1.Container{container("200m", "128Mi")},
+			},
+			want: Resources{
+				// init container runs along with the sidecar: 1100m, app containers with the sidecar: 192Mi
+				Requests: Ask{CPU: 1100, Memory: 192 << 20},
+				Limits:   Ask{Memory: 192 << 20},
+			},
+		},
+		{
+			name: "partial limits",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{{Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+					Limits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+				}}},
+				Containers: []v1.Container{
+					container("100m", "64Mi"),
+					{Resources: v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("200m")},
+						Limits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")},
+					}},
+				},
+			},
+			want: Resources{
+				// the pod is not bounded by the limits set by some containers only
+				Requests: Ask{CPU: 300, Memory: 64 << 20},
+			},
+		},
+		{
+			name: "extended resources",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{{Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{"aws.amazon.com/neuron": resource.MustParse("2")},
+				}}},
+				Containers: []v1.Container{{Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{"aws.amazon.com/neuron": resource.MustParse("1"), "nvidia.com/mig-1g.5gb": resource.MustParse("1")},
+				}}},
+			},
+			want: Resources{
+				Requests: Ask{Extended: map[string]int64{"aws.amazon.com/neuron": 2, "nvidia.com/mig-1g.5gb": 1}},
+			},
+		},
+		{
+			name: "pod overhead",
+			spec: v1.PodSpec{
+				Containers: []v1.Container{container("200m", "128Mi")},
+				Overhead:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("250m"), v1.ResourceMemory: resource.MustParse("120Mi")},
+			},
+			want: Resources{
+				Requests: Ask{CPU: 450, Memory: 248 << 20},
+				// overhead is added to set limits only
+				Limits:   Ask{Memory: 248 << 20},
+				Overhead: Ask{CPU: 250, Memory: 120 << 20},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GetPodResources(&v1.Pod{Spec: tt.spec})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetPodResources() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetContainersInfo(t *testing.T) {
+	always := v1.ContainerRestartPolicyAlways
+	pod := &v1.Pod{
+		Spec: v1.PodSpec{
+			InitContainers: []v1.Container{
+				{Name: "init", Image: "busybox"},
+				{Name: "istio-proxy", Image: "istio/proxyv2", RestartPolicy: &always, Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+				}},
+			},
+			Containers: []v1.Container{{Name: "app", Image: "app:v1", Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")},
+				Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse("2Gi")},
+			}}},
+		},
+		Status: v1.PodStatus{
+			ContainerStatuses: []v1.ContainerStatus{{
+				Name:                 "app",
+				RestartCount:         3,
+				LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled"}},
+			}},
+		},
+	}
+	want := []ContainerInfo{
+		{Name: "init", Image: "busybox", Type: ContainerTypeInit},
+		{Name: "istio-proxy", Image: "istio/proxyv2", Type: ContainerTypeSidecar, Requests: Ask{CPU: 100}},
+		{Name: "app", Image: "app:v1", Type: ContainerTypeApp, Requests: Ask{Memory: 1 << 30}, Limits: Ask{Memory: 2 << 30}, RestartCount: 3, LastTerminationReason: "OOMKilled"},
+	}
+	if got := GetContainersInfo(pod); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetContainersInfo() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+package usage
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// schemaType is the subset of Avro schema types describing record fields
+type schemaType struct {
+	Type   interface{}   `json:"type"`
+	Name   string        `json:"name"`
+	Fields []schemaField `json:"fields"`
+	Items  interface{}   `json:"items"`
+	Values interface{}   `json:"values"`
+}
+
+type schemaField struct {
+	Name string      `json:"name"`
+	Type interface{} `json:"type"`
+}
+
+// schemaRecord returns the record of the field type: record, nullable record, array or map of records or named record
+func schemaRecord(t interface{}, named map[string]*schemaType) *schemaType {
+	switch v := t.(type) {
+	case string:
+		return named[v]
+	case []interface{}:
+		for _, u := range v {
+			if record := schemaRecord(u, named); record != nil {
+				return record
+			}
+		}
+	case map[string]interface{}:
+		data, _ := json.Marshal(v)
+		var st schemaType
+		if json.Unmarshal(data, &st) != nil {
+			return nil
+		}
+		switch st.Type {
+		case "record":
+			named[st.Name] = &st
+			for _, field := range st.Fields {
+				schemaRecord(field.Type, named)
+			}
+			return &st
+		case "array":
+			return schemaRecord(st.Items, named)
+		case "map":
+			return schemaRecord(st.Values, named)
+		}
+	}
+	return nil
+}
+
+// checkSchemaFields reports the JSON fields of the type missing in the schema record
+func checkSchemaFields(t *testing.T, path string, typ reflect.Type, record *schemaType, named map[string]*schemaType) {
+	fields := make(map[string]interface{}, len(record.Fields))
+	for _, field := range record.Fields {
+		fields[field.Name] = field.Type
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fieldType, ok := fields[name]
+		if !ok {
+			t.Errorf("schema record %s has no field %s", path, name)
+			continue
+		}
+		goType := typ.Field(i).Type
+		for goType.Kind() == reflect.Ptr || goType.Kind() == reflect.Slice || goType.Kind() == reflect.Map {
+			goType = goType.Elem()
+		}
+		if goType.Kind() != reflect.Struct || goType == reflect.TypeOf(time.Time{}) {
+			continue
+		}
+		if nested := schemaRecord(fieldType, named); nested != nil {
+			checkSchemaFields(t, path+"."+name, goType, nested, named)
+		} else {
+			t.Errorf("schema field %s.%s is not a record", path, name)
+		}
+	}
+}
+
+func TestSchemaMatchesPodInfo(t *testing.T) {
+	data, err := os.ReadFile("../../schema/schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err = json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	named := make(map[string]*schemaType)
+	record := schemaRecord(schema, named)
+	if record == nil {
+		t.Fatal("schema is not a record")
+	}
+	checkSchemaFields(t, record.Name, reflect.TypeOf(PodInfo{}), record, named)
+}
@@ -0,0 +1,40 @@
+package usage
+
+import (
+	"time"
+)
+
+// RecordTypeLoadBalancer is the record type of LoadBalancer Service records
+const RecordTypeLoadBalancer = "load_balancer"
+
+// LoadBalancerInfo is the load balancer of the LoadBalancer Service record
+type LoadBalancerInfo struct {
+	// Type: clb or nlb
+	Type     string `json:"type"`
+	Hostname string `json:"hostname,omitempty"`
+	// HourlyCost of the load balancer, zero till the load balancer is provisioned
+	HourlyCost float64 `json:"hourly_cost"`
+}
+
+// GetLoadBalancerInfo returns the LoadBalancer Service record for the beginTime-endTime interval
+func GetLoadBalancerInfo(cluster, name, namespace string, created time.Time, lb *LoadBalancerInfo, beginTime, endTime time.Time) *PodInfo {
+	record := &PodInfo{
+		Name:         name,
+		Namespace:    namespace,
+		RecordType:   RecordTypeLoadBalancer,
+		Node:         NodeInfo{Cluster: cluster},
+		LoadBalancer: lb,
+		StartTime:    created,
+		BeginTime:    beginTime,
+		EndTime:      endTime,
+	}
+	// service created during the interval
+	if created.After(beginTime) {
+		record.BeginTime = created
+	}
+	if hours := record.EndTime.Sub(record.BeginTime).Hours(); hours > 0 {
+		record.Cost.LoadBalancer = lb.HourlyCost * hours
+		record.Cost.Total = record.Cost.LoadBalancer
+	}
+	return record
+}
@@ -0,0 +1,66 @@
+package usage
+
+// UsageSample is a point-in-time measurement of pod resources usage
+type UsageSample struct {
+	// CPU millicores
+	CPU int64
+	// Memory working set bytes
+	Memory int64
+	// StorageEphemeral used bytes
+	StorageEphemeral int64
+}
+
+// ResourceUsage is the actual pod resources usage over the record interval
+type ResourceUsage struct {
+	// CPU millicores
+	CPUAvg  int64 `json:"cpu_avg"`
+	CPUPeak int64 `json:"cpu_peak"`
+	// Memory working set bytes
+	MemoryAvg  int64 `json:"memory_avg"`
+	MemoryPeak int64 `json:"memory_peak"`
+	// StorageEphemeral used bytes, collected from kubelet stats only
+	StorageEphemeralAvg  int64 `json:"storage_ephemeral_avg,omitempty"`
+	StorageEphemeralPeak int64 `json:"storage_ephemeral_peak,omitempty"`
+	// Samples is the number of usage samples taken over the interval
+	Samples int64 `json:"samples"`
+}
+
+// UsageAccumulator aggregates usage samples into average and peak usage
+type UsageAccumulator struct {
+	samples int64
+	sum     UsageSample
+	peak    UsageSample
+}
+
+// Add adds the usage sample
+func (a *UsageAccumulator) Add(sample UsageSample) {
+	a.samples++
+	a.sum.CPU += sample.CPU
+	a.sum.Memory += sample.Memory
+	a.sum.StorageEphemeral += sample.StorageEphemeral
+	if sample.CPU > a.peak.CPU {
+		a.peak.CPU = sample.CPU
+	}
+	if sample.Memory > a.peak.Memory {
+		a.peak.Memory = sample.Memory
+	}
+	if sample.StorageEphemeral > a.peak.StorageEphemeral {
+		a.peak.StorageEphemeral = sample.StorageEphemeral
+	}
+}
+
+// Usage returns the average and peak usage of the samples added, nil without samples
+func (a *UsageAccumulator) Usage() *ResourceUsage {
+	if a == nil || a.samples == 0 {
+		return nil
+	}
+	return &ResourceUsage{
+		CPUAvg:               a.sum.CPU / a.samples,
+		CPUPeak:              a.peak.CPU,
+		MemoryAvg:            a.sum.Memory / a.samples,
+		MemoryPeak:           a.peak.Memory,
+		StorageEphemeralAvg:  a.sum.StorageEphemeral / a.samples,
+		StorageEphemeralPeak: a.peak.StorageEphemeral,
+		Samples:              a.samples,
+	}
+}
@@ -0,0 +1,59 @@
+package usage
+
+import (
+	"time"
+)
+
+const (
+	// RecordTypeVolume is the record type of persistent volume records
+	RecordTypeVolume = "volume"
+	// UnboundVolumeNamespace is the reserved namespace of persistent volume records without claim
+	UnboundVolumeNamespace = "__unbound__"
+)
+
+// VolumeInfo is the persistent volume of the volume record
+type VolumeInfo struct {
+	StorageClass string `json:"storage_class,omitempty"`
+	Provisioner  string `json:"provisioner,omitempty"`
+	// VolumeType: gp2, gp3, io1, io2, st1, sc1, standard or efs
+	VolumeType string `json:"volume_type,omitempty"`
+	// Size in bytes
+	Size int64 `json:"size"`
+	// IOPS provisioned
+	IOPS int64 `json:"iops,omitempty"`
+	// Throughput provisioned in MiB/s
+	Throughput int64 `json:"throughput,omitempty"`
+	// Claim is the bound PersistentVolumeClaim name, in the record namespace
+	Claim string `json:"claim,omitempty"`
+	// Pods consuming the claim
+	Pods []string `json:"pods,omitempty"`
+	// HourlyCost of the volume, zero if the volume type is not priced, e.g. metered EFS volumes
+	HourlyCost float64 `json:"hourly_cost"`
+}
+
+// GetVolumeInfo returns the persistent volume record for the beginTime-endTime interval
+func GetVolumeInfo(cluster, name, namespace string, created time.Time, volume *VolumeInfo, beginTime, endTime time.Time) *PodInfo {
+	record := &PodInfo{
+		Name:       name,
+		Namespace:  namespace,
+		RecordType: RecordTypeVolume,
+		Node:       NodeInfo{Cluster: cluster},
+		Volume:     volume,
+		StartTime:  created,
+		BeginTime:  beginTime,
+		EndTime:    endTime,
+	}
+	if record.Namespace == "" {
+		record.Namespace = UnboundVolumeNamespace
+	}
+	// volume created during the interval
+	if created.After(beginTime) {
+		record.BeginTime = created
+	}
+	record.Resources.Requests.Storage = volume.Size
+	if hours := record.EndTime.Sub(record.BeginTime).Hours(); hours > 0 {
+		record.Cost.Storage = volume.HourlyCost * hours
+		record.Cost.Total = record.Cost.Storage
+	}
+	return record
+}